@@ -2,20 +2,86 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"os"
+	"path/filepath"
+
+	"github.com/WiggidyW/eve_industry_program_fetcher/fetcher"
+	"github.com/WiggidyW/eve_industry_program_fetcher/sqlite"
+)
+
+const (
+	configFile    = "fetcher_config.json"
+	jwksCacheFile = "jwks_cache.json"
+
+	defaultCallbackUrl = "http://localhost:8080/callback"
+	defaultCacheDir    = ".esi_cache"
 )
 
 type Config struct {
-	ClientId      string  `json:"client_id"`
-	ClientSecret  string  `json:"client_secret"`
-	RefreshToken  string  `json:"refresh_token"`
-	CorporationId int32   `json:"corporation_id"`
-	RegionIds     []int32 `json:"region_ids"`
-	LocationIds   []int64 `json:"location_ids"`
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+	// if set, rotated refresh tokens are written here instead of configFile
+	CredentialsFile string  `json:"credentials_file"`
+	CorporationId   int32   `json:"corporation_id"`
+	RegionIds       []int32 `json:"region_ids"`
+	LocationIds     []int64 `json:"location_ids"`
+	// if set, the top level credentials and corporation are ignored and each
+	// identity is fetched separately
+	Identities []Identity `json:"identities"`
+	// limits on concurrent requests, shared by every dataset and identity
+	MaxInFlight        int `json:"max_in_flight"`
+	MaxInFlightPerHost int `json:"max_in_flight_per_host"`
+	// where ESI responses are cached for conditional requests
+	CacheDir string `json:"cache_dir"`
+	// where outputs are written, the working directory if empty
+	OutDir string `json:"out_dir"`
+	// if > 0, this many timestamped copies of each output are kept
+	History int `json:"history"`
+	// if set, outputs are wrapped in an envelope describing how they were
+	// fetched
+	Envelope bool `json:"envelope"`
+	// file formats each output is written in, e.g. 'json', 'csv', 'ndjson',
+	// 'msgpack', or any of them suffixed with '.gz', defaults to 'json'
+	Formats []string `json:"formats"`
+	// if > 0, each market order book is truncated to its best price levels
+	// covering this many units
+	OrderDepth uint64 `json:"order_depth"`
+	// if set, market order levels also list their orders with IDs, issue
+	// times, minimum volumes and ranges
+	FullOrders bool `json:"full_orders"`
+	// if set, outputs are also stored as snapshots in this SQLite database
+	SqlitePath string `json:"sqlite_path"`
+	// endpoints, overridable to target Singularity or a local mock
+	EsiBaseUrl    string `json:"esi_base_url"`
+	EsiVersion    string `json:"esi_version"`
+	EsiDatasource string `json:"esi_datasource"`
+	SsoBaseUrl    string `json:"sso_base_url"`
+	// only used for login
+	CallbackUrl string   `json:"callback_url"`
+	Scopes      []string `json:"scopes"`
+}
+
+// a character whose refresh token is used to fetch one corporation's data
+type Identity struct {
+	Name string `json:"name"`
+	// client_id, client_secret, region_ids and location_ids default to the
+	// top level values
+	ClientId        string  `json:"client_id"`
+	ClientSecret    string  `json:"client_secret"`
+	RefreshToken    string  `json:"refresh_token"`
+	CredentialsFile string  `json:"credentials_file"`
+	CorporationId   int32   `json:"corporation_id"`
+	RegionIds       []int32 `json:"region_ids"`
+	LocationIds     []int64 `json:"location_ids"`
+	// if empty, the datasets selected by flags are fetched
+	Datasets []string `json:"datasets"`
 }
 
 func LoadConfig() (config Config, err error) {
-	file, err := os.Open("fetcher_config.json")
+	file, err := os.Open(configFile)
 	if err != nil {
 		return Config{}, err
 	}
@@ -26,5 +92,165 @@ func LoadConfig() (config Config, err error) {
 		return Config{}, err
 	}
 
+	if config.CallbackUrl == "" {
+		config.CallbackUrl = defaultCallbackUrl
+	}
+	if config.Scopes == nil {
+		config.Scopes = fetcher.DefaultScopes
+	}
+	if config.CacheDir == "" {
+		config.CacheDir = defaultCacheDir
+	}
+
+	err = config.validateIdentities()
+	if err != nil {
+		return Config{}, err
+	}
+
 	return config, nil
 }
+
+// ESI and SSO settings left empty in the config are defaulted by the fetcher
+func (c Config) NewClient(recordDir string, replayDir string) (*fetcher.Client, error) {
+	return fetcher.NewClient(fetcher.ClientOptions{
+		EsiBaseUrl:         c.EsiBaseUrl,
+		EsiVersion:         c.EsiVersion,
+		EsiDatasource:      c.EsiDatasource,
+		SsoBaseUrl:         c.SsoBaseUrl,
+		MaxInFlight:        c.MaxInFlight,
+		MaxInFlightPerHost: c.MaxInFlightPerHost,
+		CacheDir:           c.CacheDir,
+		JwksCacheFile:      jwksCacheFile,
+		RecordDir:          recordDir,
+		ReplayDir:          replayDir,
+		Logger:             log.Default(),
+	})
+}
+
+func (c Config) validateIdentities() error {
+	names := make(map[string]struct{}, len(c.Identities))
+	for _, identity := range c.Identities {
+		if identity.Name == "" {
+			return fmt.Errorf("identity missing 'name'")
+		}
+		if _, ok := names[identity.Name]; ok {
+			return fmt.Errorf("duplicate identity '%s'", identity.Name)
+		}
+		names[identity.Name] = struct{}{}
+
+		for _, dataset := range identity.Datasets {
+			if !isDataset(dataset) {
+				return fmt.Errorf(
+					"identity '%s' has unknown dataset '%s'",
+					identity.Name,
+					dataset,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// returns the configured identities with defaults applied, or a single
+// unnamed identity built from the top level fields
+func (c Config) ResolvedIdentities() []Identity {
+	if len(c.Identities) == 0 {
+		return []Identity{{
+			ClientId:        c.ClientId,
+			ClientSecret:    c.ClientSecret,
+			RefreshToken:    c.RefreshToken,
+			CredentialsFile: c.CredentialsFile,
+			CorporationId:   c.CorporationId,
+			RegionIds:       c.RegionIds,
+			LocationIds:     c.LocationIds,
+		}}
+	}
+
+	identities := make([]Identity, 0, len(c.Identities))
+	for _, identity := range c.Identities {
+		if identity.ClientId == "" {
+			identity.ClientId = c.ClientId
+			identity.ClientSecret = c.ClientSecret
+		}
+		if identity.RegionIds == nil {
+			identity.RegionIds = c.RegionIds
+		}
+		if identity.LocationIds == nil {
+			identity.LocationIds = c.LocationIds
+		}
+		identities = append(identities, identity)
+	}
+	return identities
+}
+
+func (c Config) Identity(name string) (identity Identity, err error) {
+	for _, identity := range c.ResolvedIdentities() {
+		if identity.Name == name {
+			return identity, nil
+		}
+	}
+	return Identity{}, fmt.Errorf("identity '%s' not found", name)
+}
+
+// returns the identity's datasets, restricted to flagDatasets if any were
+// selected by flags
+func (i Identity) SelectDatasets(flagDatasets []string) []string {
+	if len(i.Datasets) == 0 {
+		return flagDatasets
+	} else if len(flagDatasets) == 0 {
+		return i.Datasets
+	}
+
+	datasets := make([]string, 0, len(i.Datasets))
+	for _, dataset := range i.Datasets {
+		for _, flagDataset := range flagDatasets {
+			if dataset == flagDataset {
+				datasets = append(datasets, dataset)
+				break
+			}
+		}
+	}
+	return datasets
+}
+
+// rotated refresh tokens are written to the identity's credentials file, or
+// back into the config
+func (i Identity) TokenStore() fetcher.FileTokenStore {
+	if i.CredentialsFile != "" {
+		return fetcher.FileTokenStore{Path: i.CredentialsFile}
+	}
+	return fetcher.FileTokenStore{Path: configFile, Identity: i.Name}
+}
+
+func (c Config) Encoders() (encoders []fetcher.Encoder, err error) {
+	encoders = make([]fetcher.Encoder, 0, len(c.Formats))
+	for _, format := range c.Formats {
+		encoder, err := fetcher.ParseFormat(format)
+		if err != nil {
+			return nil, err
+		}
+		encoders = append(encoders, encoder)
+	}
+	return encoders, nil
+}
+
+// outputs of named identities are written to a directory of the same name
+// under OutDir
+//
+// store may be nil if SqlitePath is not set
+func (c Config) OutputWriter(
+	identity Identity,
+	encoders []fetcher.Encoder,
+	store *sqlite.Store,
+) fetcher.OutputWriter {
+	out := fetcher.OutputWriter{
+		Dir:      filepath.Join(c.OutDir, identity.Name),
+		History:  c.History,
+		Envelope: c.Envelope,
+		Encoders: encoders,
+	}
+	if store != nil {
+		out.Sinks = []fetcher.Sink{store.Sink(identity.Name)}
+	}
+	return out
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/WiggidyW/eve_industry_program_fetcher/fetcher"
+)
+
+const (
+	DatasetAdjustedPrices = fetcher.DatasetAdjustedPrices
+	DatasetCostIndices    = fetcher.DatasetCostIndices
+	DatasetMarketOrders   = fetcher.DatasetMarketOrders
+	DatasetAssets         = fetcher.DatasetAssets
+)
+
+var allDatasets = []string{
+	DatasetAdjustedPrices,
+	DatasetCostIndices,
+	DatasetMarketOrders,
+	DatasetAssets,
+}
+
+func datasetFile(dataset string) string {
+	switch dataset {
+	case DatasetAdjustedPrices:
+		return fetcher.AdjustedPricesFile
+	case DatasetCostIndices:
+		return fetcher.CostIndicesFile
+	case DatasetMarketOrders:
+		return fetcher.MarketOrdersFile
+	case DatasetAssets:
+		return fetcher.AssetsFile
+	default:
+		return ""
+	}
+}
+
+// the options market orders are fetched with for identity, completing
+// marketOrders
+func marketOrdersOptions(
+	identity Identity,
+	tokens fetcher.TokenSource,
+	marketOrders fetcher.MarketOrdersOptions,
+) fetcher.MarketOrdersOptions {
+	marketOrders.Tokens = tokens
+	marketOrders.RegionIds = identity.RegionIds
+	marketOrders.LocationIds = identity.LocationIds
+	return marketOrders
+}
+
+func assetsOptions(identity Identity, tokens fetcher.TokenSource) fetcher.AssetsOptions {
+	return fetcher.AssetsOptions{Tokens: tokens, CorporationId: identity.CorporationId}
+}
+
+// the inputs the dataset's output is fetched with for identity
+func datasetInputs(
+	dataset string,
+	identity Identity,
+	marketOrders fetcher.MarketOrdersOptions,
+) fetcher.EnvelopeInputs {
+	switch dataset {
+	case DatasetMarketOrders:
+		return marketOrdersOptions(identity, nil, marketOrders).Inputs()
+	case DatasetAssets:
+		return assetsOptions(identity, nil).Inputs()
+	default:
+		return fetcher.EnvelopeInputs{}
+	}
+}
+
+// returns the expiry of the dataset's previous output if it has not passed
+//
+// partial outputs are never fresh, so that missing sources are retried, and
+// neither are outputs fetched or written with different inputs
+func datasetFreshUntil(
+	dataset string,
+	out fetcher.OutputWriter,
+	inputs fetcher.EnvelopeInputs,
+) (
+	expires time.Time,
+	fresh bool,
+) {
+	meta, err := fetcher.ReadOutputMeta(out.Dir, datasetFile(dataset))
+	if err != nil || !time.Now().Before(meta.Expires) || meta.Missing != nil {
+		return time.Time{}, false
+	} else if !meta.Inputs.Equal(fetcher.NewOutputInputs(out, inputs)) {
+		return time.Time{}, false
+	}
+	for _, name := range out.EncodedNames(datasetFile(dataset)) {
+		if _, err = os.Stat(out.Path(name)); err != nil {
+			return time.Time{}, false
+		}
+	}
+	return meta.Expires, true
+}
+
+func isDataset(name string) bool {
+	for _, dataset := range allDatasets {
+		if dataset == name {
+			return true
+		}
+	}
+	return false
+}
+
+func requiredScopes(dataset string, identity Identity) []string {
+	switch dataset {
+	case DatasetMarketOrders:
+		if len(identity.LocationIds) > 0 {
+			return []string{"esi-markets.structure_markets.v1"}
+		}
+		return nil
+	case DatasetAssets:
+		return []string{
+			"esi-assets.read_corporation_assets.v1",
+			"esi-corporations.read_blueprints.v1",
+		}
+	default:
+		return nil
+	}
+}
+
+// datasets with no required scopes only use public routes
+func needsTokens(datasets []string, identity Identity) bool {
+	for _, dataset := range datasets {
+		if len(requiredScopes(dataset, identity)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// returns an error listing every requested dataset whose scopes are not
+// granted by the access token
+func checkDatasetScopes(
+	claims fetcher.AccessTokenClaims,
+	datasets []string,
+	identity Identity,
+) error {
+	var missing []string
+	for _, dataset := range datasets {
+		var datasetMissing []string
+		for _, scope := range requiredScopes(dataset, identity) {
+			if !claims.HasScope(scope) {
+				datasetMissing = append(datasetMissing, scope)
+			}
+		}
+		if len(datasetMissing) > 0 {
+			missing = append(missing, fmt.Sprintf(
+				"  -%s: %s",
+				dataset,
+				strings.Join(datasetMissing, ", "),
+			))
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf(
+		"access token for character '%s' (%d) is missing scopes required by:\n%s\nrun 'login' again with these scopes granted",
+		claims.CharacterName,
+		claims.CharacterId,
+		strings.Join(missing, "\n"),
+	)
+}
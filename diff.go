@@ -0,0 +1,148 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/WiggidyW/eve_industry_program_fetcher/fetcher"
+)
+
+func runDiff(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: diff [flags] <old market orders> <new market orders>, each a 'json' or 'json.gz' output")
+		flags.PrintDefaults()
+	}
+	changes := flags.Bool("changes", false, "Print every changed order instead of a summary per type")
+	jsonOut := flags.Bool("json", false, "Print the diff as JSON")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return fmt.Errorf("expected 2 market orders files, got %d", flags.NArg())
+	}
+
+	oldOrders, oldInputs, _, err := readMarketOrders(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	newOrders, newInputs, fetchedAt, err := readMarketOrders(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	// orders past the depth of a truncated book, or at a source only one
+	// snapshot has, would show up as new or removed
+	for i, inputs := range []fetcher.EnvelopeInputs{oldInputs, newInputs} {
+		if inputs.Depth > 0 {
+			return fmt.Errorf(
+				"market orders '%s' were truncated to %d units per book, fetch them again without '-order_depth'",
+				flags.Arg(i),
+				inputs.Depth,
+			)
+		} else if inputs.Missing != nil {
+			return fmt.Errorf(
+				"market orders '%s' are partial, some regions or structures failed with '-keep_going', fetch them again",
+				flags.Arg(i),
+			)
+		}
+	}
+	if !sameSources(oldInputs, newInputs) {
+		return fmt.Errorf(
+			"market orders '%s' and '%s' were fetched from different regions or structures",
+			flags.Arg(0),
+			flags.Arg(1),
+		)
+	}
+
+	diffs, err := fetcher.DiffLocationOrders(oldOrders, newOrders, fetchedAt)
+	if errors.Is(err, fetcher.ErrNotFullOrders) {
+		return fmt.Errorf("%w, fetch them again with '-full_orders'", err)
+	} else if err != nil {
+		return err
+	}
+
+	if *jsonOut {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diffs)
+	} else if *changes {
+		printOrderChanges(diffs)
+	} else {
+		printDiffSummary(diffs)
+	}
+	return nil
+}
+
+// whether both inputs list the same regions and structures, in any order
+func sameSources(a fetcher.EnvelopeInputs, b fetcher.EnvelopeInputs) bool {
+	return sameIds(a.RegionIds, b.RegionIds) && sameIds(a.LocationIds, b.LocationIds)
+}
+
+func sameIds[ID cmp.Ordered](a []ID, b []ID) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+func printDiffSummary(diffs []fetcher.TypeOrdersDiff) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "LOCATION\tTYPE\tNEW\tREMOVED\tPRICE_CHANGED\tPARTIALLY_FILLED\tSELL_TRADED\tBUY_TRADED\t")
+	for _, diff := range diffs {
+		fmt.Fprintf(
+			w,
+			"%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+			diff.LocationId,
+			diff.TypeId,
+			diff.Count(fetcher.OrderNew),
+			diff.Count(fetcher.OrderRemoved),
+			diff.Count(fetcher.OrderPriceChanged),
+			diff.Count(fetcher.OrderPartiallyFilled),
+			diff.SellVolumeTraded,
+			diff.BuyVolumeTraded,
+		)
+	}
+	w.Flush()
+}
+
+func printOrderChanges(diffs []fetcher.TypeOrdersDiff) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LOCATION\tTYPE\tORDER\tSIDE\tCHANGE\tPRICE\tVOLUME")
+	for _, diff := range diffs {
+		for _, change := range diff.Changes {
+			side := "sell"
+			if change.IsBuyOrder {
+				side = "buy"
+			}
+			kind := change.Kind
+			if change.Expired {
+				kind += " (expired)"
+			}
+			price := fmt.Sprint(change.Price)
+			if change.Kind == fetcher.OrderPriceChanged {
+				price = fmt.Sprintf("%v -> %v", change.OldPrice, change.Price)
+			}
+			volume := fmt.Sprint(change.Volume)
+			if change.Kind == fetcher.OrderPartiallyFilled {
+				volume = fmt.Sprintf("%d -> %d", change.OldVolume, change.Volume)
+			}
+			fmt.Fprintf(
+				w,
+				"%d\t%d\t%d\t%s\t%s\t%s\t%s\n",
+				diff.LocationId,
+				diff.TypeId,
+				change.OrderId,
+				side,
+				kind,
+				price,
+				volume,
+			)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,98 @@
+package fetcher
+
+import (
+	"context"
+)
+
+const (
+	DatasetAdjustedPrices = "adjusted_prices"
+	AdjustedPricesFile    = "adjusted_prices.json"
+)
+
+func (c *Client) GetAndWriteAdjustedPrices(
+	ctx context.Context,
+	out OutputWriter,
+) error {
+	adjustedPrices, snapshot, err := c.GetSerializableAdjustedPrices(ctx)
+	if err != nil {
+		return err
+	}
+	envelope := newEnvelope(out, DatasetAdjustedPrices, snapshot, EnvelopeInputs{})
+	err = adjustedPrices.Write(out, envelope)
+	if err != nil {
+		return err
+	}
+	err = out.writeSinks(ctx, DatasetAdjustedPrices, adjustedPrices, snapshot)
+	if err != nil {
+		return err
+	}
+	return writeOutputMeta(out, AdjustedPricesFile, OutputMeta{Snapshot: snapshot}, EnvelopeInputs{})
+}
+
+func (c *Client) GetSerializableAdjustedPrices(ctx context.Context) (
+	serializableAdjustedPrices SerializableAdjustedPrices,
+	snapshot Snapshot,
+	err error,
+) {
+	adjustedPrices, snapshot, err := c.GetAdjustedPrices(ctx)
+	if err != nil {
+		return nil, Snapshot{}, err
+	}
+	return AdjustedPricesToSerializable(adjustedPrices), snapshot, nil
+}
+
+func (c *Client) GetAdjustedPrices(ctx context.Context) (
+	adjustedPrices []AdjustedPriceEntry,
+	snapshot Snapshot,
+	err error,
+) {
+	adjustedPrices = make([]AdjustedPriceEntry, 0)
+	snapshot, err = getPage[[]AdjustedPriceEntry](
+		ctx,
+		c,
+		c.esi.url("/markets/prices/"),
+		nil,
+		&adjustedPrices,
+	)
+	if err != nil {
+		return nil, Snapshot{}, err
+	}
+
+	return adjustedPrices, snapshot, nil
+}
+
+type AdjustedPriceEntry struct {
+	AdjustedPrice float64 `json:"adjusted_price"`
+	TypeId        int32   `json:"type_id"`
+}
+
+type SerializableAdjustedPrices map[int32]float64
+
+// writes the data with every encoder of out
+func (s SerializableAdjustedPrices) Write(out OutputWriter, envelope *Envelope) error {
+	return writeSerializable(out, AdjustedPricesFile, s, envelope)
+}
+
+func (s SerializableAdjustedPrices) Columns() []string {
+	return []string{"type_id", "adjusted_price"}
+}
+
+func (s SerializableAdjustedPrices) Rows() [][]any {
+	rows := make([][]any, 0, len(s))
+	for _, typeId := range sortedKeys(s) {
+		rows = append(rows, []any{typeId, s[typeId]})
+	}
+	return rows
+}
+
+func (s SerializableAdjustedPrices) Counts() map[string]int {
+	return map[string]int{"types": len(s)}
+}
+
+func AdjustedPricesToSerializable(prices []AdjustedPriceEntry) SerializableAdjustedPrices {
+	m := make(map[int32]float64)
+	for _, v := range prices {
+		m[v.TypeId] = v.AdjustedPrice
+	}
+	return m
+}
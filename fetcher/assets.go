@@ -1,136 +1,138 @@
-package main
+package fetcher
 
 import (
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
+	"context"
 	"sync"
 )
 
-func GetAndWriteAssets(
-	accessToken string,
-	corporationId int32,
+const (
+	DatasetAssets = "assets"
+	AssetsFile    = "assets.json"
+)
+
+type AssetsOptions struct {
+	// must belong to a character with the corporation's director role
+	Tokens        TokenSource
+	CorporationId int32
+}
+
+// the inputs recorded in the envelope and meta of outputs fetched with o
+func (o AssetsOptions) Inputs() EnvelopeInputs {
+	return EnvelopeInputs{CorporationId: o.CorporationId}
+}
+
+func (c *Client) GetAndWriteAssets(
+	ctx context.Context,
+	opts AssetsOptions,
+	out OutputWriter,
 ) error {
-	serializableLocationOutAssets, err := GetSerializableLocationOutAssets(
-		accessToken,
-		corporationId,
-	)
+	serializableLocationOutAssets, snapshot, err := c.GetSerializableLocationOutAssets(ctx, opts)
+	if err != nil {
+		return err
+	}
+	envelope := newEnvelope(out, DatasetAssets, snapshot, opts.Inputs())
+	err = serializableLocationOutAssets.Write(out, envelope)
 	if err != nil {
 		return err
 	}
-	return serializableLocationOutAssets.Write()
+	err = out.writeSinks(ctx, DatasetAssets, serializableLocationOutAssets, snapshot)
+	if err != nil {
+		return err
+	}
+	return writeOutputMeta(out, AssetsFile, OutputMeta{Snapshot: snapshot}, opts.Inputs())
 }
 
-func GetSerializableLocationOutAssets(
-	accessToken string,
-	corporationId int32,
+func (c *Client) GetSerializableLocationOutAssets(
+	ctx context.Context,
+	opts AssetsOptions,
 ) (
 	serializableLocationOutAssets SerializableLocationOutAssets,
+	snapshot Snapshot,
 	err error,
 ) {
-	assets, blueprints, err := GetAssetsAndBlueprints(accessToken, corporationId)
+	assets, blueprints, snapshot, err := c.GetAssetsAndBlueprints(ctx, opts)
 	if err != nil {
-		return nil, err
+		return nil, Snapshot{}, err
 	}
-	return AssetsToSerializable(assets, blueprints), nil
+	return AssetsToSerializable(assets, blueprints), snapshot, nil
 }
 
-func GetAssetsAndBlueprints(
-	accessToken string,
-	corporationId int32,
+func (c *Client) GetAssetsAndBlueprints(
+	ctx context.Context,
+	opts AssetsOptions,
 ) (
 	assets []AssetsEntry,
 	blueprints []BlueprintsEntry,
+	snapshot Snapshot,
 	err error,
 ) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	wg := new(sync.WaitGroup)
 	wg.Add(1)
 
+	var assetsSnapshot Snapshot
 	var assetsErr error
 	go func() {
-		assets, assetsErr = GetAssets(accessToken, corporationId)
+		assets, assetsSnapshot, assetsErr = c.GetAssets(ctx, opts.Tokens, opts.CorporationId)
 		wg.Done()
 	}()
 
-	blueprints, blueprintsErr := GetBlueprints(accessToken, corporationId)
+	blueprints, blueprintsSnapshot, blueprintsErr := c.GetBlueprints(ctx, opts.Tokens, opts.CorporationId)
 	if blueprintsErr != nil {
-		return nil, nil, blueprintsErr
+		// stop fetching assets and wait for it to return
+		cancel()
+		wg.Wait()
+		return nil, nil, Snapshot{}, blueprintsErr
 	}
 
 	wg.Wait()
 	if assetsErr != nil {
-		return nil, nil, assetsErr
+		return nil, nil, Snapshot{}, assetsErr
 	}
 
-	return assets, blueprints, nil
+	return assets, blueprints, assetsSnapshot.Combine(blueprintsSnapshot), nil
 }
 
-func GetBlueprints(
-	accessToken string,
+func (c *Client) GetBlueprints(
+	ctx context.Context,
+	tokens TokenSource,
 	corporationId int32,
 ) (
 	blueprints []BlueprintsEntry,
+	snapshot Snapshot,
 	err error,
 ) {
-	chn, pages, _, err := getPages[[]BlueprintsEntry](
-		fmt.Sprintf(
-			"https://esi.evetech.net/latest/corporations/%d/blueprints/?datasource=tranquility",
+	return getAllPages[BlueprintsEntry](
+		ctx,
+		c,
+		c.esi.url(
+			"/corporations/%d/blueprints/",
 			corporationId,
 		),
-		accessToken,
-		func() *[]BlueprintsEntry {
-			blueprints := make([]BlueprintsEntry, 0, 1000)
-			return &blueprints
-		},
+		tokens,
 	)
-	if err != nil {
-		return nil, err
-	}
-
-	blueprints = make([]BlueprintsEntry, 0, pages*1000)
-	for i := 0; i < pages; i++ {
-		pageResult := <-chn
-		if pageResult.Err != nil {
-			return nil, pageResult.Err
-		}
-		blueprints = append(blueprints, pageResult.Model...)
-	}
-
-	return blueprints, nil
 }
 
-func GetAssets(
-	accessToken string,
+func (c *Client) GetAssets(
+	ctx context.Context,
+	tokens TokenSource,
 	corporationId int32,
 ) (
 	assets []AssetsEntry,
+	snapshot Snapshot,
 	err error,
 ) {
-	chn, pages, _, err := getPages[[]AssetsEntry](
-		fmt.Sprintf(
-			"https://esi.evetech.net/latest/corporations/%d/assets/?datasource=tranquility",
+	return getAllPages[AssetsEntry](
+		ctx,
+		c,
+		c.esi.url(
+			"/corporations/%d/assets/",
 			corporationId,
 		),
-		accessToken,
-		func() *[]AssetsEntry {
-			assets := make([]AssetsEntry, 0, 1000)
-			return &assets
-		},
+		tokens,
 	)
-	if err != nil {
-		return nil, err
-	}
-
-	assets = make([]AssetsEntry, 0, pages*1000)
-	for i := 0; i < pages; i++ {
-		pageResult := <-chn
-		if pageResult.Err != nil {
-			return nil, pageResult.Err
-		}
-		assets = append(assets, pageResult.Model...)
-	}
-
-	return assets, nil
 }
 
 type HasItemId interface {
@@ -179,14 +181,38 @@ type SerializableOutAsset struct {
 
 type SerializableLocationOutAssets map[int64][]SerializableOutAsset
 
-func (s SerializableLocationOutAssets) Serialize() ([]byte, error) { return json.Marshal(s) }
+// writes the data with every encoder of out
+func (s SerializableLocationOutAssets) Write(out OutputWriter, envelope *Envelope) error {
+	return writeSerializable(out, AssetsFile, s, envelope)
+}
 
-func (s SerializableLocationOutAssets) Write() error {
-	data, err := s.Serialize()
-	if err != nil {
-		return err
+func (s SerializableLocationOutAssets) Columns() []string {
+	return []string{"location_id", "type_id", "runs", "me", "te", "quantity"}
+}
+
+func (s SerializableLocationOutAssets) Rows() [][]any {
+	rows := make([][]any, 0, len(s))
+	for _, locationId := range sortedKeys(s) {
+		for _, v := range s[locationId] {
+			rows = append(rows, []any{
+				locationId,
+				v.TypeId,
+				v.Runs,
+				v.MaterialEfficiency,
+				v.TimeEfficiency,
+				v.Quantity,
+			})
+		}
+	}
+	return rows
+}
+
+func (s SerializableLocationOutAssets) Counts() map[string]int {
+	assets := 0
+	for _, outAssets := range s {
+		assets += len(outAssets)
 	}
-	return ioutil.WriteFile("assets.json", data, 0644)
+	return map[string]int{"locations": len(s), "assets": assets}
 }
 
 func AssetsToSerializable(assets []AssetsEntry, blueprints []BlueprintsEntry) SerializableLocationOutAssets {
@@ -0,0 +1,73 @@
+package fetcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// an on-disk cache of ESI responses keyed by URL, used to send conditional
+// requests and reuse bodies on 304 Not Modified
+//
+// a nil responseCache caches nothing
+type responseCache struct {
+	dir    string
+	logger *log.Logger
+}
+
+type cacheEntry struct {
+	Url    string          `json:"url"`
+	Header http.Header     `json:"header"`
+	Body   json.RawMessage `json:"body"`
+}
+
+func (e cacheEntry) etag() string { return e.Header.Get("ETag") }
+
+// returns a nil responseCache if dir is empty
+func newResponseCache(dir string, logger *log.Logger) (*responseCache, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &responseCache{dir: dir, logger: logger}, nil
+}
+
+func (c *responseCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// returns false if there is no usable entry for url
+func (c *responseCache) get(url string) (entry cacheEntry, ok bool) {
+	if c == nil {
+		return cacheEntry{}, false
+	}
+	data, err := os.ReadFile(c.path(url))
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	if err = json.Unmarshal(data, &entry); err != nil || entry.Url != url {
+		return cacheEntry{}, false
+	}
+	return entry, entry.etag() != ""
+}
+
+// failing to write an entry only costs a full download next run
+func (c *responseCache) put(entry cacheEntry) {
+	if c == nil || entry.etag() == "" {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = writeFileAtomic(c.path(entry.Url), data, 0644)
+	}
+	if err != nil {
+		c.logger.Printf("error caching '%s': '%s'", entry.Url, err)
+	}
+}
@@ -0,0 +1,110 @@
+package fetcher
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// fetches datasets from ESI, safe for concurrent use
+//
+// every request made through one Client shares its concurrency limits, ESI
+// error budget and response cache
+type Client struct {
+	httpClient    *http.Client
+	esi           EsiRoutes
+	ssoBaseUrl    string
+	governor      *errorLimitGovernor
+	scheduler     *requestScheduler
+	cache         *responseCache
+	jwksCacheFile string
+	jwksMu        sync.Mutex
+	jwks          *jwksCache
+	logger        *log.Logger
+}
+
+type ClientOptions struct {
+	// default to https://esi.evetech.net, 'latest' and 'tranquility'
+	EsiBaseUrl    string
+	EsiVersion    string
+	EsiDatasource string
+	// defaults to https://login.eveonline.com
+	SsoBaseUrl string
+	// limits on concurrent requests, default to 50 and 20
+	MaxInFlight        int
+	MaxInFlightPerHost int
+	// if set, ESI responses are cached here for conditional requests
+	//
+	// ignored when recording or replaying, as fixtures must hold full
+	// responses rather than 304s
+	CacheDir string
+	// if set, the JWKS document used to validate access tokens is cached here
+	// across runs
+	JwksCacheFile string
+	// if set, ESI responses are recorded into this fixture directory
+	RecordDir string
+	// if set, ESI responses are served from this fixture directory instead
+	// of the network
+	ReplayDir string
+	// defaults to discarding log output
+	Logger *log.Logger
+}
+
+func NewClient(opts ClientOptions) (c *Client, err error) {
+	if opts.EsiBaseUrl == "" {
+		opts.EsiBaseUrl = defaultEsiBaseUrl
+	}
+	if opts.EsiVersion == "" {
+		opts.EsiVersion = defaultEsiVersion
+	}
+	if opts.EsiDatasource == "" {
+		opts.EsiDatasource = defaultEsiDatasource
+	}
+	if opts.SsoBaseUrl == "" {
+		opts.SsoBaseUrl = defaultSsoBaseUrl
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = defaultMaxInFlight
+	}
+	if opts.MaxInFlightPerHost <= 0 {
+		opts.MaxInFlightPerHost = defaultMaxInFlightPerHost
+	}
+	if opts.RecordDir != "" || opts.ReplayDir != "" {
+		opts.CacheDir = ""
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New(io.Discard, "", 0)
+	}
+
+	c = &Client{
+		esi: EsiRoutes{
+			BaseUrl:    opts.EsiBaseUrl,
+			Version:    opts.EsiVersion,
+			Datasource: opts.EsiDatasource,
+		},
+		ssoBaseUrl:    opts.SsoBaseUrl,
+		governor:      &errorLimitGovernor{},
+		scheduler:     newRequestScheduler(opts.MaxInFlight, opts.MaxInFlightPerHost),
+		jwksCacheFile: opts.JwksCacheFile,
+		logger:        opts.Logger,
+	}
+
+	c.cache, err = newResponseCache(opts.CacheDir, c.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := newTransport(
+		opts.MaxInFlightPerHost,
+		opts.RecordDir,
+		opts.ReplayDir,
+		c.esi.host(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	c.httpClient = &http.Client{Transport: transport}
+
+	return c, nil
+}
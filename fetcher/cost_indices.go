@@ -0,0 +1,125 @@
+package fetcher
+
+import (
+	"context"
+)
+
+const (
+	DatasetCostIndices = "cost_indices"
+	CostIndicesFile    = "cost_indices.json"
+)
+
+func (c *Client) GetAndWriteCostIndices(
+	ctx context.Context,
+	out OutputWriter,
+) error {
+	serializableCostIndices, snapshot, err := c.GetSerializableCostIndices(ctx)
+	if err != nil {
+		return err
+	}
+	envelope := newEnvelope(out, DatasetCostIndices, snapshot, EnvelopeInputs{})
+	err = serializableCostIndices.Write(out, envelope)
+	if err != nil {
+		return err
+	}
+	err = out.writeSinks(ctx, DatasetCostIndices, serializableCostIndices, snapshot)
+	if err != nil {
+		return err
+	}
+	return writeOutputMeta(out, CostIndicesFile, OutputMeta{Snapshot: snapshot}, EnvelopeInputs{})
+}
+
+func (c *Client) GetSerializableCostIndices(ctx context.Context) (
+	serializableCostIndices SerializableCostIndices,
+	snapshot Snapshot,
+	err error,
+) {
+	costIndices, snapshot, err := c.GetCostIndices(ctx)
+	if err != nil {
+		return nil, Snapshot{}, err
+	}
+	return CostIndicesToSerializable(costIndices), snapshot, nil
+}
+
+func (c *Client) GetCostIndices(ctx context.Context) (
+	costIndices []CostIndicesEntry,
+	snapshot Snapshot,
+	err error,
+) {
+	costIndices = make([]CostIndicesEntry, 0)
+	snapshot, err = getPage[[]CostIndicesEntry](
+		ctx,
+		c,
+		c.esi.url("/industry/systems/"),
+		nil,
+		&costIndices,
+	)
+	if err != nil {
+		return nil, Snapshot{}, err
+	}
+
+	return costIndices, snapshot, nil
+}
+
+type CostIndicesSubEntry struct {
+	Activity  string  `json:"activity"`
+	CostIndex float64 `json:"cost_index"`
+}
+
+type CostIndicesEntry struct {
+	CostIndices []CostIndicesSubEntry `json:"cost_indices"`
+	SystemId    int32                 `json:"solar_system_id"`
+}
+
+type SerializableCostIndicesValue struct {
+	Manufacturing float64 `json:"manufacturing"`
+	Invention     float64 `json:"invention"`
+	Reaction      float64 `json:"reaction"`
+	Copy          float64 `json:"copy"`
+}
+
+type SerializableCostIndices map[int32]SerializableCostIndicesValue
+
+// writes the data with every encoder of out
+func (s SerializableCostIndices) Write(out OutputWriter, envelope *Envelope) error {
+	return writeSerializable(out, CostIndicesFile, s, envelope)
+}
+
+func (s SerializableCostIndices) Columns() []string {
+	return []string{"system_id", "manufacturing", "invention", "reaction", "copy"}
+}
+
+func (s SerializableCostIndices) Rows() [][]any {
+	rows := make([][]any, 0, len(s))
+	for _, systemId := range sortedKeys(s) {
+		v := s[systemId]
+		rows = append(rows, []any{systemId, v.Manufacturing, v.Invention, v.Reaction, v.Copy})
+	}
+	return rows
+}
+
+func (s SerializableCostIndices) Counts() map[string]int {
+	return map[string]int{"systems": len(s)}
+}
+
+func CostIndicesToSerializable(costIndices []CostIndicesEntry) SerializableCostIndices {
+	m := make(map[int32]SerializableCostIndicesValue)
+	for _, v := range costIndices {
+		value := SerializableCostIndicesValue{}
+		for _, subEntry := range v.CostIndices {
+			switch subEntry.Activity {
+			case "manufacturing":
+				value.Manufacturing = subEntry.CostIndex
+			case "copying":
+				value.Copy = subEntry.CostIndex
+			case "invention":
+				value.Invention = subEntry.CostIndex
+			case "reaction":
+				value.Reaction = subEntry.CostIndex
+			default:
+			}
+		}
+		m[v.SystemId] = value
+	}
+	return m
+}
@@ -0,0 +1,227 @@
+package fetcher
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"time"
+)
+
+const (
+	OrderNew          = "new"
+	OrderRemoved      = "removed"
+	OrderPriceChanged = "price_changed"
+	// the order's remaining volume shrank
+	OrderPartiallyFilled = "partially_filled"
+)
+
+// returned when diffing market orders fetched without MarketOrdersOptions.Full
+var ErrNotFullOrders = errors.New("market orders do not list their orders")
+
+// a change to a single order between two snapshots
+type OrderChange struct {
+	Kind       string  `json:"kind"`
+	OrderId    int64   `json:"order_id"`
+	IsBuyOrder bool    `json:"is_buy_order"`
+	Price      float64 `json:"price"`
+	// set for price changes
+	OldPrice float64 `json:"old_price,omitempty"`
+	// the volume remaining, or that was remaining before removal
+	Volume uint64 `json:"volume"`
+	// set for partial fills
+	OldVolume uint64 `json:"old_volume,omitempty"`
+	// set for removed orders whose duration had run out
+	Expired bool `json:"expired,omitempty"`
+}
+
+// the changes to one type's orders at one location
+type TypeOrdersDiff struct {
+	LocationId int64         `json:"location_id"`
+	TypeId     int32         `json:"type_id"`
+	Changes    []OrderChange `json:"changes"`
+	// units that left sell orders through partial fills and removals that
+	// were not expiries, i.e. what was bought from them
+	//
+	// ESI does not tell filled orders apart from cancelled ones, so this is
+	// an upper bound
+	SellVolumeTraded uint64 `json:"sell_volume_traded"`
+	// the same for buy orders, i.e. what was sold to them
+	BuyVolumeTraded uint64 `json:"buy_volume_traded"`
+}
+
+func (d TypeOrdersDiff) Count(kind string) (count int) {
+	for _, change := range d.Changes {
+		if change.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+type diffEntry struct {
+	SerializableOrder
+	isBuyOrder bool
+	price      float64
+}
+
+// compares two full snapshots of market orders, as returned by
+// GetSerializableLocationOrders with MarketOrdersOptions.Full, returning the
+// types whose orders changed sorted by location and type
+//
+// removed orders whose duration ran out before at, usually when newOrders
+// were fetched, are marked as expired and not counted as traded
+//
+// neither snapshot should be truncated with MarketOrdersOptions.Depth or
+// partial, and both should be fetched from the same regions and structures,
+// otherwise orders past the depth or at sources only one snapshot has would
+// show up as new or removed
+func DiffLocationOrders(
+	oldOrders SerializableLocationOrders,
+	newOrders SerializableLocationOrders,
+	at time.Time,
+) (
+	diffs []TypeOrdersDiff,
+	err error,
+) {
+	if !oldOrders.Full() || !newOrders.Full() {
+		return nil, ErrNotFullOrders
+	}
+
+	locationIds := sortedKeys(oldOrders)
+	for _, locationId := range sortedKeys(newOrders) {
+		if _, ok := oldOrders[locationId]; !ok {
+			locationIds = append(locationIds, locationId)
+		}
+	}
+	slices.Sort(locationIds)
+
+	diffs = []TypeOrdersDiff{}
+	for _, locationId := range locationIds {
+		oldTypes, newTypes := oldOrders[locationId], newOrders[locationId]
+		typeIds := sortedKeys(oldTypes)
+		for _, typeId := range sortedKeys(newTypes) {
+			if _, ok := oldTypes[typeId]; !ok {
+				typeIds = append(typeIds, typeId)
+			}
+		}
+		slices.Sort(typeIds)
+
+		for _, typeId := range typeIds {
+			diff := diffTypeOrders(oldTypes[typeId], newTypes[typeId], at)
+			if len(diff.Changes) > 0 {
+				diff.LocationId, diff.TypeId = locationId, typeId
+				diffs = append(diffs, diff)
+			}
+		}
+	}
+	return diffs, nil
+}
+
+func diffTypeOrders(
+	oldTypeOrders *SerializableTypeOrders,
+	newTypeOrders *SerializableTypeOrders,
+	at time.Time,
+) (diff TypeOrdersDiff) {
+	oldEntries, newEntries := oldTypeOrders.entries(), newTypeOrders.entries()
+
+	for orderId, newEntry := range newEntries {
+		oldEntry, ok := oldEntries[orderId]
+		if !ok {
+			diff.Changes = append(diff.Changes, newEntry.change(OrderNew))
+			continue
+		}
+		if newEntry.price != oldEntry.price {
+			change := newEntry.change(OrderPriceChanged)
+			change.OldPrice = oldEntry.price
+			diff.Changes = append(diff.Changes, change)
+		}
+		if newEntry.Volume < oldEntry.Volume {
+			change := newEntry.change(OrderPartiallyFilled)
+			change.OldVolume = oldEntry.Volume
+			diff.Changes = append(diff.Changes, change)
+			diff.addTraded(newEntry.isBuyOrder, oldEntry.Volume-newEntry.Volume)
+		}
+	}
+
+	for orderId, oldEntry := range oldEntries {
+		if _, ok := newEntries[orderId]; ok {
+			continue
+		}
+		change := oldEntry.change(OrderRemoved)
+		expires := oldEntry.Issued.AddDate(0, 0, int(oldEntry.Duration))
+		change.Expired = !oldEntry.Issued.IsZero() && !at.Before(expires)
+		diff.Changes = append(diff.Changes, change)
+		if !change.Expired {
+			diff.addTraded(oldEntry.isBuyOrder, oldEntry.Volume)
+		}
+	}
+
+	slices.SortFunc(diff.Changes, func(a, b OrderChange) int {
+		if a.OrderId != b.OrderId {
+			return cmp.Compare(a.OrderId, b.OrderId)
+		}
+		return cmp.Compare(a.Kind, b.Kind)
+	})
+	return diff
+}
+
+func (d *TypeOrdersDiff) addTraded(isBuyOrder bool, volume uint64) {
+	if isBuyOrder {
+		d.BuyVolumeTraded += volume
+	} else {
+		d.SellVolumeTraded += volume
+	}
+}
+
+func (e diffEntry) change(kind string) OrderChange {
+	return OrderChange{
+		Kind:       kind,
+		OrderId:    e.OrderId,
+		IsBuyOrder: e.isBuyOrder,
+		Price:      e.price,
+		Volume:     e.Volume,
+	}
+}
+
+// the listed orders of both books keyed by ID, empty if t is nil
+func (t *SerializableTypeOrders) entries() map[int64]diffEntry {
+	entries := make(map[int64]diffEntry)
+	if t == nil {
+		return entries
+	}
+	for _, book := range []struct {
+		isBuyOrder bool
+		levels     []SerializableLevel
+	}{
+		{false, t.Sell.Levels},
+		{true, t.Buy.Levels},
+	} {
+		for _, level := range book.levels {
+			for _, entry := range level.Entries {
+				entries[entry.OrderId] = diffEntry{
+					SerializableOrder: entry,
+					isBuyOrder:        book.isBuyOrder,
+					price:             level.Price,
+				}
+			}
+		}
+	}
+	return entries
+}
+
+// whether the levels list their orders, i.e. the orders were fetched with
+// MarketOrdersOptions.Full
+func (s SerializableLocationOrders) Full() bool {
+	for _, serializableOrders := range s {
+		for _, typeOrders := range serializableOrders {
+			for _, book := range []SerializableBook{typeOrders.Sell, typeOrders.Buy} {
+				for _, level := range book.Levels {
+					if level.Entries == nil {
+						return false
+					}
+				}
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package fetcher
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDiffLocationOrders(t *testing.T) {
+	const locationId, typeId, unchangedTypeId = 60003760, 34, 35
+	at := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+	recent, longAgo := at.Add(-24*time.Hour), at.AddDate(0, 0, -30)
+	entry := func(orderId int64, isBuyOrder bool, price float64, volume int32, issued time.Time) OrdersRegionEntry {
+		return OrdersRegionEntry{
+			OrderId:      orderId,
+			LocationId:   locationId,
+			TypeId:       typeId,
+			IsBuyOrder:   isBuyOrder,
+			Price:        price,
+			VolumeRemain: volume,
+			Issued:       issued,
+			Duration:     7,
+		}
+	}
+	unchanged := OrdersRegionEntry{OrderId: 7, LocationId: locationId, TypeId: unchangedTypeId, Price: 1, VolumeRemain: 1}
+
+	oldOrders := OrdersToSerializable([][]OrdersRegionEntry{{
+		entry(1, false, 5, 100, recent),
+		entry(2, false, 6, 50, longAgo),
+		entry(3, false, 7, 20, recent),
+		entry(4, true, 4, 10, recent),
+		entry(6, true, 3.5, 8, recent),
+		unchanged,
+	}}, nil)
+	newOrders := OrdersToSerializable([][]OrdersRegionEntry{{
+		entry(1, false, 5, 60, recent),
+		entry(4, true, 4.5, 10, recent),
+		entry(5, true, 3, 5, recent),
+		unchanged,
+	}}, nil)
+
+	diffs, err := DiffLocationOrders(oldOrders, newOrders, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].LocationId != locationId || diffs[0].TypeId != typeId {
+		t.Fatalf("got diffs %+v, expected only type %d at %d", diffs, typeId, locationId)
+	}
+	diff := diffs[0]
+
+	expected := []OrderChange{
+		{Kind: OrderPartiallyFilled, OrderId: 1, Price: 5, Volume: 60, OldVolume: 100},
+		{Kind: OrderRemoved, OrderId: 2, Price: 6, Volume: 50, Expired: true},
+		{Kind: OrderRemoved, OrderId: 3, Price: 7, Volume: 20},
+		{Kind: OrderPriceChanged, OrderId: 4, IsBuyOrder: true, Price: 4.5, OldPrice: 4, Volume: 10},
+		{Kind: OrderNew, OrderId: 5, IsBuyOrder: true, Price: 3, Volume: 5},
+		{Kind: OrderRemoved, OrderId: 6, IsBuyOrder: true, Price: 3.5, Volume: 8},
+	}
+	if len(diff.Changes) != len(expected) {
+		t.Fatalf("got changes %+v, expected %+v", diff.Changes, expected)
+	}
+	for i, change := range diff.Changes {
+		if change != expected[i] {
+			t.Errorf("got change %+v, expected %+v", change, expected[i])
+		}
+	}
+
+	// the expired order was not traded
+	if diff.SellVolumeTraded != 60 {
+		t.Errorf("got %d sell volume traded, expected 60", diff.SellVolumeTraded)
+	}
+	if diff.BuyVolumeTraded != 8 {
+		t.Errorf("got %d buy volume traded, expected 8", diff.BuyVolumeTraded)
+	}
+}
+
+func TestDiffLocationOrdersRequiresFullOrders(t *testing.T) {
+	orders := OrdersToSerializable([][]OrdersRegionEntry{{
+		{OrderId: 1, LocationId: 60003760, TypeId: 34, Price: 5, VolumeRemain: 10},
+	}}, nil)
+	compact := OrdersToSerializable([][]OrdersRegionEntry{{
+		{OrderId: 1, LocationId: 60003760, TypeId: 34, Price: 5, VolumeRemain: 10},
+	}}, nil)
+	compact.Compact()
+
+	if _, err := DiffLocationOrders(orders, compact, time.Now()); !errors.Is(err, ErrNotFullOrders) {
+		t.Errorf("got error %v, expected %v", err, ErrNotFullOrders)
+	}
+}
@@ -0,0 +1,230 @@
+package fetcher
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// implemented by every Serializable* type, and open to other data written
+// with an Encoder or passed to a Sink
+type Serializable interface {
+	// names of the columns of Rows
+	Columns() []string
+	// the data flattened into one row per record, for CSV and NDJSON
+	Rows() [][]any
+	// record counts reported in envelopes, keyed by what they count
+	Counts() map[string]int
+}
+
+// encodes a Serializable into one output file format
+type Encoder interface {
+	// the extension of files written with this encoder, without a leading dot
+	Ext() string
+	// envelope is nil if outputs are not wrapped in one
+	Encode(w io.Writer, s Serializable, envelope *Envelope) error
+}
+
+var DefaultEncoders = []Encoder{JsonEncoder{}}
+
+// returns the encoder for a format name, which is its file extension, e.g.
+// 'json', 'csv', 'ndjson', 'msgpack' or 'csv.gz'
+func ParseFormat(format string) (Encoder, error) {
+	if inner, ok := strings.CutSuffix(format, ".gz"); ok {
+		encoder, err := ParseFormat(inner)
+		if err != nil {
+			return nil, err
+		}
+		return GzipEncoder{Encoder: encoder}, nil
+	}
+
+	switch format {
+	case "json":
+		return JsonEncoder{}, nil
+	case "csv":
+		return CsvEncoder{}, nil
+	case "ndjson":
+		return NdjsonEncoder{}, nil
+	case "msgpack":
+		return MsgpackEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("unknown format '%s'", format)
+	}
+}
+
+// encodes the data as it is shaped in memory, as a single JSON document
+type JsonEncoder struct{}
+
+func (JsonEncoder) Ext() string { return "json" }
+
+func (JsonEncoder) Encode(w io.Writer, s Serializable, envelope *Envelope) error {
+	data, err := marshalEnveloped(s, envelope, s.Counts())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// encodes one JSON object per row, preceded by the envelope without its data
+// if there is one
+type NdjsonEncoder struct{}
+
+func (NdjsonEncoder) Ext() string { return "ndjson" }
+
+func (NdjsonEncoder) Encode(w io.Writer, s Serializable, envelope *Envelope) error {
+	buf := new(bytes.Buffer)
+	if envelope != nil {
+		header := *envelope
+		header.Counts = s.Counts()
+		data, err := json.Marshal(header)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	// objects are built by hand to keep the keys in column order
+	columns := s.Columns()
+	for _, row := range s.Rows() {
+		buf.WriteByte('{')
+		for i, value := range row {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(columns[i])
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(data)
+		}
+		buf.WriteString("}\n")
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// encodes a header and one line per row
+//
+// CSV has no room for an envelope, so it is left out
+type CsvEncoder struct{}
+
+func (CsvEncoder) Ext() string { return "csv" }
+
+func (CsvEncoder) Encode(w io.Writer, s Serializable, envelope *Envelope) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(s.Columns()); err != nil {
+		return err
+	}
+	record := make([]string, len(s.Columns()))
+	for _, row := range s.Rows() {
+		for i, value := range row {
+			record[i] = csvField(value)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvField(value any) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// encodes the same document as JsonEncoder as MessagePack
+type MsgpackEncoder struct{}
+
+func (MsgpackEncoder) Ext() string { return "msgpack" }
+
+func (MsgpackEncoder) Encode(w io.Writer, s Serializable, envelope *Envelope) error {
+	data, err := marshalEnveloped(s, envelope, s.Counts())
+	if err != nil {
+		return err
+	}
+
+	// round trip through a generic JSON value, so that MessagePack follows
+	// the same field names as JSON
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err = decoder.Decode(&value); err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	if err = writeMsgpack(buf, value); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// compresses the output of another encoder
+type GzipEncoder struct {
+	Encoder Encoder
+}
+
+func (e GzipEncoder) Ext() string { return e.Encoder.Ext() + ".gz" }
+
+func (e GzipEncoder) Encode(w io.Writer, s Serializable, envelope *Envelope) error {
+	gz := gzip.NewWriter(w)
+	if err := e.Encoder.Encode(gz, s, envelope); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+// writes s with every encoder of out, naming each file after name with the
+// encoder's extension
+func writeSerializable(out OutputWriter, name string, s Serializable, envelope *Envelope) error {
+	for _, encoder := range out.encoders() {
+		buf := new(bytes.Buffer)
+		if err := encoder.Encode(buf, s, envelope); err != nil {
+			return err
+		}
+		if err := out.Write(encodedName(name, encoder), buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaces the '.json' extension of an output file name with the encoder's
+func encodedName(name string, encoder Encoder) string {
+	return strings.TrimSuffix(name, ".json") + "." + encoder.Ext()
+}
+
+// so that rows come out in the same order every run
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,94 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// bumped whenever the layout of an output's data changes incompatibly
+const SchemaVersion = 3
+
+// reported in envelopes, set at build time with
+// '-ldflags "-X github.com/WiggidyW/eve_industry_program_fetcher/fetcher.Version=v1.2.3"'
+var Version = "dev"
+
+// optionally wraps an output's data so that consumers can reject stale or
+// mismatched inputs
+type Envelope struct {
+	SchemaVersion  int            `json:"schema_version"`
+	FetcherVersion string         `json:"fetcher_version"`
+	Dataset        string         `json:"dataset"`
+	FetchedAt      time.Time      `json:"fetched_at"`
+	Expires        time.Time      `json:"expires"`
+	LastModified   time.Time      `json:"last_modified"`
+	Inputs         EnvelopeInputs `json:"inputs"`
+	// record counts, e.g. 'locations' and 'orders', keyed by what they count
+	Counts map[string]int `json:"counts"`
+	// left out of the header line of NDJSON outputs
+	Data any `json:"data,omitempty"`
+}
+
+// the configuration an output was fetched with
+type EnvelopeInputs struct {
+	CorporationId int32   `json:"corporation_id,omitempty"`
+	RegionIds     []int32 `json:"region_ids,omitempty"`
+	LocationIds   []int64 `json:"location_ids,omitempty"`
+	// the units each market order book was truncated to
+	Depth uint64 `json:"depth,omitempty"`
+	// whether market order levels list their orders
+	Full bool `json:"full,omitempty"`
+	// sources left out of a partial output
+	Missing *MissingOrders `json:"missing,omitempty"`
+}
+
+// returns an envelope for dataset if out is configured to write them, and nil
+// otherwise
+func newEnvelope(
+	out OutputWriter,
+	dataset string,
+	snapshot Snapshot,
+	inputs EnvelopeInputs,
+) *Envelope {
+	if !out.Envelope {
+		return nil
+	}
+	return &Envelope{
+		SchemaVersion:  SchemaVersion,
+		FetcherVersion: Version,
+		Dataset:        dataset,
+		FetchedAt:      time.Now().UTC(),
+		Expires:        snapshot.Expires,
+		LastModified:   snapshot.LastModified,
+		Inputs:         inputs,
+	}
+}
+
+// marshals data, wrapped in envelope with counts if envelope is not nil
+func marshalEnveloped(data any, envelope *Envelope, counts map[string]int) ([]byte, error) {
+	if envelope == nil {
+		return json.Marshal(data)
+	}
+	wrapped := *envelope
+	wrapped.Counts = counts
+	wrapped.Data = data
+	return json.Marshal(wrapped)
+}
+
+// decodes an output's data into v, whether or not it is wrapped in an
+// envelope, returning the envelope if there is one
+func UnmarshalOutput(data []byte, v any) (envelope *Envelope, err error) {
+	var probe struct {
+		SchemaVersion int             `json:"schema_version"`
+		Data          json.RawMessage `json:"data"`
+	}
+	// bare outputs are maps keyed by ids, which never have these keys
+	if json.Unmarshal(data, &probe) == nil && probe.SchemaVersion > 0 && probe.Data != nil {
+		envelope = &Envelope{}
+		if err = json.Unmarshal(data, envelope); err != nil {
+			return nil, err
+		}
+		envelope.Data = nil
+		return envelope, json.Unmarshal(probe.Data, v)
+	}
+	return nil, json.Unmarshal(data, v)
+}
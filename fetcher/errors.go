@@ -0,0 +1,109 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// returned when ESI responds with anything other than 200 OK
+type StatusError struct {
+	StatusCode int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("http status code: %d", e.StatusCode)
+}
+
+// returned by getPages when every attempt at fetching a page failed
+type PageError struct {
+	Url      string
+	Page     int
+	Attempts int
+	// the status code of the last attempt, 0 if it received no response
+	StatusCode int
+	Err        error
+}
+
+func newPageError(url string, page int, attempts int, err error) *PageError {
+	pageErr := &PageError{
+		Url:      url,
+		Page:     page,
+		Attempts: attempts,
+		Err:      err,
+	}
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		pageErr.StatusCode = statusErr.StatusCode
+	}
+	return pageErr
+}
+
+func (e *PageError) Error() string {
+	return fmt.Sprintf(
+		"error fetching '%s' page '%d' after %d attempts (last status %d): %s",
+		e.Url,
+		e.Page,
+		e.Attempts,
+		e.StatusCode,
+		e.Err,
+	)
+}
+
+func (e *PageError) Unwrap() error { return e.Err }
+
+// returned by getAllPages when the pages of a collection kept coming from
+// different ESI cache snapshots
+type SnapshotError struct {
+	Url      string
+	Attempts int
+}
+
+func (e *SnapshotError) Error() string {
+	return fmt.Sprintf(
+		"pages of '%s' came from inconsistent snapshots in %d attempts",
+		e.Url,
+		e.Attempts,
+	)
+}
+
+// returned when an access token could not be obtained from SSO
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("error authenticating: %s", e.Err)
+}
+
+func (e *AuthError) Unwrap() error { return e.Err }
+
+// returned when an output file could not be written
+type WriteError struct {
+	// the dataset instead for outputs written to a Sink
+	Path string
+	Err  error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("error writing '%s': %s", e.Path, e.Err)
+}
+
+func (e *WriteError) Unwrap() error { return e.Err }
+
+// returned by GetOrders with KeepGoing set when some regions or structures
+// failed, alongside the orders of those that did not
+type MissingOrdersError struct {
+	Missing MissingOrders
+	Errs    []error
+}
+
+func (e *MissingOrdersError) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("orders missing for %s", strings.Join(msgs, "; "))
+}
+
+func (e *MissingOrdersError) Unwrap() []error { return e.Errs }
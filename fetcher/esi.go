@@ -0,0 +1,40 @@
+package fetcher
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultSsoBaseUrl    = "https://login.eveonline.com"
+	defaultEsiBaseUrl    = "https://esi.evetech.net"
+	defaultEsiVersion    = "latest"
+	defaultEsiDatasource = "tranquility"
+)
+
+// where ESI routes are requested from, so that Singularity or a local mock
+// can stand in for Tranquility
+type EsiRoutes struct {
+	BaseUrl    string
+	Version    string
+	Datasource string
+}
+
+func (e EsiRoutes) url(format string, args ...any) string {
+	return fmt.Sprintf(
+		"%s/%s%s?datasource=%s",
+		strings.TrimSuffix(e.BaseUrl, "/"),
+		e.Version,
+		fmt.Sprintf(format, args...),
+		url.QueryEscape(e.Datasource),
+	)
+}
+
+func (e EsiRoutes) host() string {
+	u, err := url.Parse(e.BaseUrl)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,689 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ESI responds with this when the error limit has been exceeded
+	statusErrorLimited     = 420
+	maxErrorLimitedRetries = 3
+	// all requests are paused until the window resets once fewer errors than
+	// this remain
+	errorLimitThreshold = 10
+	// used when a 420 response is missing the reset header
+	defaultErrorLimitReset = 60 * time.Second
+)
+
+// tracks the ESI error budget reported by every response, pausing all
+// requests while it is nearly exhausted
+type errorLimitGovernor struct {
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+// blocks until requests are allowed or ctx is done
+func (g *errorLimitGovernor) wait(ctx context.Context) error {
+	for {
+		g.mu.Lock()
+		pause := time.Until(g.pausedUntil)
+		g.mu.Unlock()
+		if pause <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, pause); err != nil {
+			return err
+		}
+	}
+}
+
+func (g *errorLimitGovernor) observe(rep *http.Response, logger *log.Logger) {
+	remain, remainErr := strconv.Atoi(rep.Header.Get("X-ESI-Error-Limit-Remain"))
+	reset, resetErr := strconv.Atoi(rep.Header.Get("X-ESI-Error-Limit-Reset"))
+
+	var pause time.Duration
+	if rep.StatusCode == statusErrorLimited {
+		pause = defaultErrorLimitReset
+		if resetErr == nil {
+			pause = time.Duration(reset) * time.Second
+		}
+	} else if remainErr == nil && resetErr == nil && remain < errorLimitThreshold {
+		pause = time.Duration(reset) * time.Second
+	} else {
+		return
+	}
+
+	// wait an extra second in case our clock is behind ESI's
+	pausedUntil := time.Now().Add(pause + time.Second)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if time.Now().After(g.pausedUntil) {
+		logger.Printf("ESI error limit nearly exhausted, pausing requests for %s", pause)
+	}
+	if pausedUntil.After(g.pausedUntil) {
+		g.pausedUntil = pausedUntil
+	}
+}
+
+type EsiAuthRefreshResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func (c *Client) authenticate(
+	ctx context.Context,
+	clientId string,
+	clientSecret string,
+	refreshToken string,
+) (
+	accessToken string,
+	newRefreshToken string,
+	expires time.Time,
+	err error,
+) {
+	rep, err := c.postToken(
+		ctx,
+		clientId,
+		clientSecret,
+		fmt.Sprintf(
+			`grant_type=refresh_token&refresh_token=%s`,
+			url.QueryEscape(refreshToken),
+		),
+	)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	return rep.AccessToken,
+		rep.RefreshToken,
+		time.Now().Add(time.Duration(rep.ExpiresIn) * time.Second),
+		nil
+}
+
+func (c *Client) postToken(
+	ctx context.Context,
+	clientId string,
+	clientSecret string,
+	body string,
+) (
+	rep EsiAuthRefreshResponse,
+	err error,
+) {
+	// public clients identify themselves in the body instead of basic auth
+	if clientSecret == "" {
+		body = fmt.Sprintf("%s&client_id=%s", body, url.QueryEscape(clientId))
+	}
+
+	// build the request
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		fmt.Sprintf("%s/v2/oauth/token", strings.TrimSuffix(c.ssoBaseUrl, "/")),
+		bytes.NewBuffer([]byte(body)),
+	)
+	if err != nil {
+		return EsiAuthRefreshResponse{}, err
+	}
+	addHeaderUserAgent(req)
+	addHeaderWwwContentType(req)
+	addHeaderLoginHost(req)
+	if clientSecret != "" {
+		addHeadBasicAuth(req, clientId, clientSecret)
+	}
+
+	// fetch the response
+	httpRep, close, err := c.doRequest(req)
+	if err != nil {
+		return EsiAuthRefreshResponse{}, err
+	}
+	defer close()
+
+	err = json.NewDecoder(httpRep.Body).Decode(&rep)
+	if err != nil {
+		return EsiAuthRefreshResponse{}, err
+	}
+
+	return rep, nil
+}
+
+// identifies the ESI cache snapshot a response was served from
+type Snapshot struct {
+	Expires time.Time `json:"expires"`
+	// zero if ESI did not send 'Last-Modified'
+	LastModified time.Time `json:"last_modified"`
+}
+
+// combines the snapshots of a dataset's sources, keeping the earliest expiry
+// and the oldest data
+func (s Snapshot) Combine(other Snapshot) Snapshot {
+	return Snapshot{
+		Expires:      earliest(s.Expires, other.Expires),
+		LastModified: earliest(s.LastModified, other.LastModified),
+	}
+}
+
+// pages of one collection are consistent if they share a snapshot
+//
+// 'Last-Modified' is only compared if both responses sent it, as ESI does
+// not send it with every response
+func (s Snapshot) sameAs(other Snapshot) bool {
+	if !s.LastModified.IsZero() && !other.LastModified.IsZero() {
+		return s.LastModified.Equal(other.LastModified)
+	}
+	return s.Expires.Equal(other.Expires)
+}
+
+func (c *Client) getHead(
+	ctx context.Context,
+	url string,
+	tokens TokenSource,
+) (
+	pages int,
+	snapshot Snapshot,
+	err error,
+) {
+	// fetch the response
+	header, _, err := c.getConditional(ctx, url, tokens, addHeaderUserAgent)
+	if err != nil {
+		return 0, Snapshot{}, err
+	}
+
+	// parse the response headers
+	snapshot, err = parseHeadSnapshot(header)
+	if err != nil {
+		return 0, Snapshot{}, err
+	}
+	pages, err = parseHeadPages(header)
+	if err != nil {
+		return 0, Snapshot{}, err
+	}
+
+	return pages, snapshot, nil
+}
+
+func getPage[M any](
+	ctx context.Context,
+	c *Client,
+	url string,
+	tokens TokenSource,
+	model *M,
+) (
+	snapshot Snapshot,
+	err error,
+) {
+	// fetch the response
+	header, body, err := c.getConditional(ctx, url, tokens, addHeadJsonContentType)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	// parse the response headers
+	snapshot, err = parseHeadSnapshot(header)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	// decode the body
+	err = json.Unmarshal(body, model)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
+// GETs url, sending If-None-Match if it is cached and returning the cached
+// body, with the fresh headers applied, on 304 Not Modified
+func (c *Client) getConditional(
+	ctx context.Context,
+	url string,
+	tokens TokenSource,
+	addHeaders func(*http.Request),
+) (
+	header http.Header,
+	body []byte,
+	err error,
+) {
+	entry, cached := c.cache.get(url)
+
+	// fetch the response
+	httpRep, close, err := c.doAuthRequest(ctx, tokens, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(
+			ctx,
+			"GET",
+			url,
+			nil,
+		)
+		if err != nil {
+			return nil, err
+		}
+		addHeaders(req)
+		if cached {
+			req.Header.Set("If-None-Match", entry.etag())
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer close()
+
+	// reuse the cached body
+	if httpRep.StatusCode == http.StatusNotModified {
+		if !cached {
+			return nil, nil, StatusError{StatusCode: httpRep.StatusCode}
+		}
+		for k, v := range httpRep.Header {
+			entry.Header[k] = v
+		}
+		return entry.Header, entry.Body, nil
+	}
+
+	// read and cache the body
+	body, err = io.ReadAll(httpRep.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.cache.put(cacheEntry{Url: url, Header: httpRep.Header, Body: body})
+
+	return httpRep.Header, body, nil
+}
+
+const (
+	// only used for getPages
+	numRetries       = 3
+	baseRetryBackoff = 5 * time.Second
+	maxRetryBackoff  = 60 * time.Second
+	// only used for getAllPages
+	maxSnapshotRestarts = 3
+)
+
+// sleeps for d, returning early with ctx's error if it is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// exponential backoff with jitter, so that pages failing together do not
+// retry together
+//
+// a variable so that tests need not wait it out
+var retryBackoff = func(attempt int) time.Duration {
+	backoff := baseRetryBackoff << attempt
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff + time.Duration(rand.Int63n(int64(time.Second)))
+}
+
+// fetches every page of url, restarting the whole collection if ESI's cache
+// rolled over while the pages were being fetched
+func getAllPages[E any](
+	ctx context.Context,
+	c *Client,
+	url string,
+	tokens TokenSource,
+) (
+	entries []E,
+	snapshot Snapshot,
+	err error,
+) {
+	for restarts := 0; ; restarts++ {
+		models, headSnapshot, consistent, err := getAllPagesOnce[E](ctx, c, url, tokens)
+		if err != nil {
+			return nil, Snapshot{}, err
+		}
+
+		if consistent {
+			entries = make([]E, 0, len(models)*1000)
+			for _, model := range models {
+				entries = append(entries, model...)
+			}
+			return entries, headSnapshot, nil
+		} else if restarts >= maxSnapshotRestarts {
+			return nil, Snapshot{}, &SnapshotError{Url: url, Attempts: restarts + 1}
+		}
+
+		c.logger.Printf(
+			"'%s' changed while fetching its pages, restarting (%d/%d)",
+			url,
+			restarts+1,
+			maxSnapshotRestarts,
+		)
+	}
+}
+
+// fetches every page of url once, stopping the remaining pages as soon as one
+// fails
+func getAllPagesOnce[E any](
+	ctx context.Context,
+	c *Client,
+	url string,
+	tokens TokenSource,
+) (
+	models [][]E,
+	snapshot Snapshot,
+	consistent bool,
+	err error,
+) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chn, pages, snapshot, err := getPages[[]E](
+		ctx,
+		c,
+		url,
+		tokens,
+		func() *[]E {
+			model := make([]E, 0, 1000)
+			return &model
+		},
+	)
+	if err != nil {
+		return nil, Snapshot{}, false, err
+	}
+
+	// collect the pages in order
+	models = make([][]E, pages)
+	consistent = true
+	for i := 0; i < pages; i++ {
+		pageResult := <-chn
+		if pageResult.Err != nil {
+			return nil, Snapshot{}, false, pageResult.Err
+		}
+		models[pageResult.Page-1] = pageResult.Model
+		if !pageResult.Snapshot.sameAs(snapshot) {
+			consistent = false
+		}
+	}
+
+	return models, snapshot, consistent, nil
+}
+
+// every page is sent to the returned channel exactly once, so it never blocks
+// and the fetching goroutines exit even if the caller stops receiving
+func getPages[M any](
+	ctx context.Context,
+	c *Client,
+	url string,
+	tokens TokenSource,
+	newModel func() *M,
+) (
+	chnRecv <-chan PageResult[M],
+	pages int,
+	snapshot Snapshot,
+	err error,
+) {
+	// get the head
+	pages, snapshot, err = c.getHead(ctx, url, tokens)
+	if err != nil {
+		return nil, 0, Snapshot{}, err
+	}
+
+	// create the channel
+	chn := make(chan PageResult[M], pages)
+
+	// fetch the pages
+	for i := 1; i <= pages; i++ {
+		go func(i int) {
+			pageUrl := fmt.Sprintf("%s&page=%d", url, i)
+			var err error
+			for j := 0; j <= numRetries; j++ {
+				// a failed attempt may have partially decoded into the model
+				model := newModel()
+				var snapshot Snapshot
+				snapshot, err = getPage(ctx, c, pageUrl, tokens, model)
+				if err == nil {
+					chn <- PageResult[M]{Page: i, Model: *model, Snapshot: snapshot}
+					return
+				} else if ctx.Err() != nil {
+					chn <- PageResult[M]{Page: i, Err: ctx.Err()}
+					return
+				} else {
+					c.logger.Printf("error fetching '%s' page '%d': '%s'", url, i, err)
+				}
+				if j < numRetries {
+					if err := sleep(ctx, retryBackoff(j)); err != nil {
+						chn <- PageResult[M]{Page: i, Err: err}
+						return
+					}
+				}
+			}
+			chn <- PageResult[M]{Page: i, Err: newPageError(url, i, numRetries+1, err)}
+		}(i)
+	}
+
+	return chn, pages, snapshot, nil
+}
+
+type PageResult[M any] struct {
+	Page     int
+	Model    M
+	Snapshot Snapshot
+	Err      error
+}
+
+// returns the earlier of a and b, ignoring zero times
+func earliest(a time.Time, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+func addHeaderUserAgent(
+	req *http.Request,
+) {
+	req.Header.Add("User-Agent", "eve_industry_program_fetcher")
+}
+
+func addHeaderWwwContentType(req *http.Request) {
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+}
+
+func addHeadJsonContentType(req *http.Request) {
+	req.Header.Add("Content-Type", "application/json")
+}
+
+func addHeaderLoginHost(req *http.Request) {
+	req.Header.Add("Host", req.URL.Host)
+}
+
+func addHeadBasicAuth(req *http.Request, clientId string, clientSecret string) {
+	basic_auth := base64.StdEncoding.EncodeToString([]byte(
+		fmt.Sprintf("%s:%s", clientId, clientSecret),
+	))
+	req.Header.Add("Authorization", fmt.Sprintf("Basic %s", basic_auth))
+}
+
+func addHeadBearerAuth(req *http.Request, accessToken string) {
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+}
+
+func (c *Client) doRequest(
+	req *http.Request,
+) (
+	rep *http.Response,
+	close func() error,
+	err error,
+) {
+	for i := 0; ; i++ {
+		if err = c.governor.wait(req.Context()); err != nil {
+			return nil, voidClose, err
+		}
+		release, err := c.scheduler.acquire(req.Context(), req.URL.Host)
+		if err != nil {
+			return nil, voidClose, err
+		}
+		rep, err = c.httpClient.Do(req)
+		if err != nil {
+			release()
+			return rep, voidClose, err
+		}
+		c.governor.observe(rep, c.logger)
+
+		// bodiless requests are retried once the error limit window resets
+		if rep.StatusCode == statusErrorLimited &&
+			req.Body == nil &&
+			i < maxErrorLimitedRetries {
+			rep.Body.Close()
+			release()
+			continue
+		}
+
+		// the slot is held until the caller is done reading the body
+		close = func() error {
+			defer release()
+			return rep.Body.Close()
+		}
+		break
+	}
+
+	// 304 is only returned for conditional requests, which expect it
+	if rep.StatusCode != http.StatusOK && rep.StatusCode != http.StatusNotModified {
+		err = StatusError{StatusCode: rep.StatusCode}
+	}
+	return rep, close, err
+}
+
+func voidClose() error { return nil }
+
+// adds a bearer token to the request built by newReq, retrying once with a
+// fresh token if ESI responds with a 401
+//
+// public routes pass nil tokens and are sent without authorization
+func (c *Client) doAuthRequest(
+	ctx context.Context,
+	tokens TokenSource,
+	newReq func() (*http.Request, error),
+) (
+	rep *http.Response,
+	close func() error,
+	err error,
+) {
+	if tokens == nil {
+		req, err := newReq()
+		if err != nil {
+			return nil, voidClose, err
+		}
+		return c.doRequest(req)
+	}
+
+	for i := 0; ; i++ {
+		accessToken, err := tokens.Token(ctx)
+		if err != nil {
+			return nil, voidClose, err
+		}
+
+		req, err := newReq()
+		if err != nil {
+			return nil, voidClose, err
+		}
+		addHeadBearerAuth(req, accessToken)
+
+		rep, close, err = c.doRequest(req)
+		if i == 0 && rep != nil && rep.StatusCode == http.StatusUnauthorized {
+			close()
+			tokens.Invalidate(accessToken)
+			continue
+		}
+		return rep, close, err
+	}
+}
+
+func parseHeadExpires(header http.Header) (
+	expires time.Time,
+	err error,
+) {
+	datestring := header.Get("Expires")
+	if datestring == "" {
+		return time.Time{}, fmt.Errorf("'Expires' missing from response headers")
+	}
+
+	expires, err = time.Parse(time.RFC1123, datestring)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(
+			"error parsing 'Expires' header: %w",
+			err,
+		)
+	}
+
+	return expires, nil
+}
+
+func parseHeadSnapshot(header http.Header) (
+	snapshot Snapshot,
+	err error,
+) {
+	snapshot.Expires, err = parseHeadExpires(header)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snapshot.LastModified, err = parseHeadLastModified(header)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// returns a zero time if 'Last-Modified' is missing
+func parseHeadLastModified(header http.Header) (
+	lastModified time.Time,
+	err error,
+) {
+	datestring := header.Get("Last-Modified")
+	if datestring == "" {
+		return time.Time{}, nil
+	}
+
+	lastModified, err = time.Parse(time.RFC1123, datestring)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(
+			"error parsing 'Last-Modified' header: %w",
+			err,
+		)
+	}
+
+	return lastModified, nil
+}
+
+func parseHeadPages(header http.Header) (
+	pages int,
+	err error,
+) {
+	pagesstring := header.Get("X-Pages")
+	if pagesstring == "" {
+		return 0, fmt.Errorf("'X-Pages' missing from response headers")
+	}
+
+	pages, err = strconv.Atoi(pagesstring)
+	if err != nil {
+		return 0, fmt.Errorf(
+			"error parsing 'X-Pages' header: %w",
+			err,
+		)
+	}
+
+	return pages, nil
+}
@@ -0,0 +1,226 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serves a paged collection of ints, page p holding p*10 and p*10+1, with
+// the status of each attempt at a page chosen by status
+type pagedEsi struct {
+	pages  int
+	status func(page int, attempt int) int
+	// delays page responses, e.g. to make them arrive out of order
+	delay func(page int) time.Duration
+
+	mu       sync.Mutex
+	attempts map[int]int
+}
+
+func (e *pagedEsi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page := 1
+	if v := r.URL.Query().Get("page"); v != "" {
+		page, _ = strconv.Atoi(v)
+	}
+
+	e.mu.Lock()
+	attempt := e.attempts[page]
+	e.attempts[page]++
+	e.mu.Unlock()
+
+	if e.delay != nil {
+		time.Sleep(e.delay(page))
+	}
+
+	w.Header().Set("Expires", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	w.Header().Set("Last-Modified", "Sun, 18 Oct 2026 07:00:00 GMT")
+	w.Header().Set("X-Pages", strconv.Itoa(e.pages))
+	if status := e.status(page, attempt); status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+	fmt.Fprintf(w, "[%d,%d]", page*10, page*10+1)
+}
+
+// the number of requests made for page, including the head request for
+// page 1
+func (e *pagedEsi) attemptsAt(page int) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.attempts[page]
+}
+
+func newPagedEsi(pages int, status func(page int, attempt int) int) *pagedEsi {
+	return &pagedEsi{pages: pages, status: status, attempts: make(map[int]int)}
+}
+
+func alwaysOk(page int, attempt int) int { return http.StatusOK }
+
+// returns a client for a stand-in ESI served by handler, and the URL of its
+// paged route
+func newTestClient(t *testing.T, handler http.Handler) (c *Client, url string) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	backoff := retryBackoff
+	retryBackoff = func(attempt int) time.Duration { return time.Millisecond }
+	t.Cleanup(func() { retryBackoff = backoff })
+
+	c, err := NewClient(ClientOptions{EsiBaseUrl: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, c.esi.url("/paged/")
+}
+
+func expectedEntries(pages int) []int {
+	entries := make([]int, 0, pages*2)
+	for page := 1; page <= pages; page++ {
+		entries = append(entries, page*10, page*10+1)
+	}
+	return entries
+}
+
+func checkEntries(t *testing.T, entries []int, pages int) {
+	t.Helper()
+	expected := expectedEntries(pages)
+	if len(entries) != len(expected) {
+		t.Fatalf("got %d entries %v, expected %d", len(entries), entries, len(expected))
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Fatalf("got entries %v, expected %v", entries, expected)
+		}
+	}
+}
+
+func TestGetAllPagesReturnsPageErrorAfterEveryRetryFails(t *testing.T) {
+	esi := newPagedEsi(3, func(page int, attempt int) int {
+		if page == 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	c, url := newTestClient(t, esi)
+
+	entries, _, err := getAllPages[int](context.Background(), c, url, nil)
+	if entries != nil {
+		t.Errorf("got entries %v alongside an error", entries)
+	}
+
+	var pageErr *PageError
+	if !errors.As(err, &pageErr) {
+		t.Fatalf("got error %v, expected a *PageError", err)
+	}
+	if pageErr.Url != url {
+		t.Errorf("got url '%s', expected '%s'", pageErr.Url, url)
+	}
+	if pageErr.Page != 2 {
+		t.Errorf("got page %d, expected 2", pageErr.Page)
+	}
+	if pageErr.Attempts != numRetries+1 {
+		t.Errorf("got %d attempts, expected %d", pageErr.Attempts, numRetries+1)
+	}
+	if pageErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got last status %d, expected %d", pageErr.StatusCode, http.StatusServiceUnavailable)
+	}
+	if attempts := esi.attemptsAt(2); attempts != numRetries+1 {
+		t.Errorf("page 2 was requested %d times, expected %d", attempts, numRetries+1)
+	}
+}
+
+func TestGetAllPagesRetriesTransientFailures(t *testing.T) {
+	const pages = 4
+	esi := newPagedEsi(pages, func(page int, attempt int) int {
+		// every page but the head fails until its last retry
+		if page > 1 && attempt < numRetries {
+			return http.StatusBadGateway
+		}
+		return http.StatusOK
+	})
+	c, url := newTestClient(t, esi)
+
+	entries, _, err := getAllPages[int](context.Background(), c, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, entries, pages)
+}
+
+func TestGetAllPagesKeepsPageOrder(t *testing.T) {
+	const pages = 8
+	esi := newPagedEsi(pages, alwaysOk)
+	// earlier pages respond later, so that they arrive in reverse
+	esi.delay = func(page int) time.Duration {
+		return time.Duration(pages-page) * 5 * time.Millisecond
+	}
+	c, url := newTestClient(t, esi)
+
+	entries, _, err := getAllPages[int](context.Background(), c, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(t, entries, pages)
+}
+
+func TestSnapshotSameAs(t *testing.T) {
+	expires := time.Date(2026, 10, 18, 7, 5, 0, 0, time.UTC)
+	lastModified := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+	later := lastModified.Add(5 * time.Minute)
+
+	for _, test := range []struct {
+		name  string
+		a, b  Snapshot
+		equal bool
+	}{
+		{
+			"same last modified",
+			Snapshot{Expires: expires, LastModified: lastModified},
+			Snapshot{Expires: expires.Add(time.Second), LastModified: lastModified},
+			true,
+		},
+		{
+			"different last modified",
+			Snapshot{Expires: expires, LastModified: lastModified},
+			Snapshot{Expires: expires, LastModified: later},
+			false,
+		},
+		{
+			"only one has last modified, same expiry",
+			Snapshot{Expires: expires, LastModified: lastModified},
+			Snapshot{Expires: expires},
+			true,
+		},
+		{
+			"only the other has last modified, same expiry",
+			Snapshot{Expires: expires},
+			Snapshot{Expires: expires, LastModified: lastModified},
+			true,
+		},
+		{
+			"only one has last modified, different expiry",
+			Snapshot{Expires: expires, LastModified: lastModified},
+			Snapshot{Expires: expires.Add(5 * time.Minute)},
+			false,
+		},
+		{
+			"neither has last modified",
+			Snapshot{Expires: expires},
+			Snapshot{Expires: expires},
+			true,
+		},
+	} {
+		if equal := test.a.sameAs(test.b); equal != test.equal {
+			t.Errorf("%s: got %t, expected %t", test.name, equal, test.equal)
+		}
+	}
+}
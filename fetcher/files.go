@@ -0,0 +1,160 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	lockRetryInterval = 100 * time.Millisecond
+	lockTimeout       = 30 * time.Second
+	// a lock file older than this is assumed to be left over by a crashed run
+	lockStaleAfter = 2 * time.Minute
+)
+
+// written beside each output file as '<name>.meta.json'
+type OutputMeta struct {
+	Snapshot
+	// sources left out of a partial output
+	Missing *MissingOrders `json:"missing,omitempty"`
+	Inputs  OutputInputs   `json:"inputs"`
+}
+
+// what an output was fetched with and how it was written, so that a fresh
+// output is still fetched again once they change
+type OutputInputs struct {
+	Fetch    EnvelopeInputs `json:"fetch"`
+	Envelope bool           `json:"envelope"`
+	// the extensions of the files written
+	Formats []string `json:"formats"`
+}
+
+// returns the inputs of an output fetched with inputs and written by out
+func NewOutputInputs(out OutputWriter, inputs EnvelopeInputs) OutputInputs {
+	// which sources went missing is an outcome, not an input
+	inputs.Missing = nil
+	formats := make([]string, 0, len(out.encoders()))
+	for _, encoder := range out.encoders() {
+		formats = append(formats, encoder.Ext())
+	}
+	return OutputInputs{Fetch: inputs, Envelope: out.Envelope, Formats: formats}
+}
+
+// compares the inputs as they are written, so that empty and missing lists
+// are equal
+func (i OutputInputs) Equal(other OutputInputs) bool {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return false
+	}
+	otherData, err := json.Marshal(other)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(data, otherData)
+}
+
+// writes meta with the inputs of an output fetched with inputs
+func writeOutputMeta(
+	out OutputWriter,
+	name string,
+	meta OutputMeta,
+	inputs EnvelopeInputs,
+) error {
+	meta.Inputs = NewOutputInputs(out, inputs)
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return out.Write(metaName(name), data)
+}
+
+// reads the meta file written beside the output file name in dir, returning an
+// error if it does not exist
+func ReadOutputMeta(dir string, name string) (meta OutputMeta, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, metaName(name)))
+	if err != nil {
+		return OutputMeta{}, err
+	}
+	err = json.Unmarshal(data, &meta)
+	if err != nil {
+		return OutputMeta{}, err
+	}
+	return meta, nil
+}
+
+func metaName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".meta.json"
+}
+
+// writes data to a temp file in the same directory and renames it over path,
+// so readers never observe a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// acquires an exclusive lock on path by creating 'path.lock'
+func lockFile(ctx context.Context, path string) (
+	unlock func() error,
+	err error,
+) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(file, "%d\n", os.Getpid())
+			file.Close()
+			return func() error { return os.Remove(lockPath) }, nil
+		} else if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		// remove the lock if its owner appears to have died
+		if info, statErr := os.Stat(lockPath); statErr == nil &&
+			time.Since(info.ModTime()) > lockStaleAfter {
+			os.Remove(lockPath)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock '%s'", lockPath)
+		}
+		if err = sleep(ctx, lockRetryInterval); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package fetcher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// a recorded HTTP exchange, keyed by method and URL
+type fixture struct {
+	Method     string      `json:"method"`
+	Url        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+func fixturePath(dir string, method string, url string) string {
+	sum := sha256.Sum256([]byte(method + " " + url))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// saves every response from host into dir as a fixture
+//
+// only ESI traffic is recorded so that tokens never end up in fixtures
+type recordingTransport struct {
+	dir  string
+	host string
+	next http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rep, err := t.next.RoundTrip(req)
+	if err != nil || req.URL.Host != t.host {
+		return rep, err
+	}
+
+	body, err := io.ReadAll(rep.Body)
+	rep.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	rep.Body = io.NopCloser(bytes.NewReader(body))
+
+	data, err := json.MarshalIndent(fixture{
+		Method:     req.Method,
+		Url:        req.URL.String(),
+		StatusCode: rep.StatusCode,
+		Header:     rep.Header,
+		Body:       string(body),
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = writeFileAtomic(fixturePath(t.dir, req.Method, req.URL.String()), data, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return rep, nil
+}
+
+// serves responses from fixtures in dir instead of the network
+type replayTransport struct {
+	dir string
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	data, err := os.ReadFile(fixturePath(t.dir, req.Method, req.URL.String()))
+	if err != nil {
+		return nil, fmt.Errorf("no fixture for '%s %s': %w", req.Method, req.URL, err)
+	}
+	var f fixture
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.StatusCode, http.StatusText(f.StatusCode)),
+		StatusCode:    f.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(f.Body))),
+		ContentLength: int64(len(f.Body)),
+		Request:       req,
+	}, nil
+}
+
+// a pooled transport, wrapped to record into recordDir or replaced to replay
+// from replayDir if either is set
+func newTransport(
+	maxInFlightPerHost int,
+	recordDir string,
+	replayDir string,
+	esiHost string,
+) (
+	transport http.RoundTripper,
+	err error,
+) {
+	if recordDir != "" && replayDir != "" {
+		return nil, fmt.Errorf("cannot record and replay at the same time")
+	}
+
+	if replayDir != "" {
+		return &replayTransport{dir: replayDir}, nil
+	}
+
+	transport = newPooledTransport(maxInFlightPerHost)
+	if recordDir != "" {
+		if err := os.MkdirAll(recordDir, 0755); err != nil {
+			return nil, err
+		}
+		transport = &recordingTransport{
+			dir:  recordDir,
+			host: esiHost,
+			next: transport,
+		}
+	}
+
+	return transport, nil
+}
@@ -0,0 +1,285 @@
+package fetcher
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	jwksCacheTtl = 24 * time.Hour
+	// tolerated clock skew when checking 'exp'
+	jwtLeeway = 30 * time.Second
+)
+
+type AccessTokenClaims struct {
+	CharacterId   int32
+	CharacterName string
+	Scopes        []string
+	Expires       time.Time
+}
+
+func (c AccessTokenClaims) HasScope(scope string) bool {
+	for _, v := range c.Scopes {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtPayload struct {
+	Sub  string          `json:"sub"`
+	Name string          `json:"name"`
+	Iss  string          `json:"iss"`
+	Exp  int64           `json:"exp"`
+	Scp  json.RawMessage `json:"scp"`
+}
+
+// verifies the signature, issuer and expiry of an SSO access token and
+// returns its claims
+func (c *Client) ValidateAccessToken(
+	ctx context.Context,
+	accessToken string,
+) (
+	claims AccessTokenClaims,
+	err error,
+) {
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return AccessTokenClaims{}, fmt.Errorf("access token is not a JWT")
+	}
+
+	// decode the header and payload
+	var header jwtHeader
+	if err = decodeJwtSegment(parts[0], &header); err != nil {
+		return AccessTokenClaims{}, fmt.Errorf("error decoding JWT header: %w", err)
+	}
+	var payload jwtPayload
+	if err = decodeJwtSegment(parts[1], &payload); err != nil {
+		return AccessTokenClaims{}, fmt.Errorf("error decoding JWT payload: %w", err)
+	}
+
+	// verify the signature
+	if header.Alg != "RS256" {
+		return AccessTokenClaims{}, fmt.Errorf("unsupported JWT alg '%s'", header.Alg)
+	}
+	key, err := c.getJwksKey(ctx, header.Kid)
+	if err != nil {
+		return AccessTokenClaims{}, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return AccessTokenClaims{}, fmt.Errorf("error decoding JWT signature: %w", err)
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature)
+	if err != nil {
+		return AccessTokenClaims{}, fmt.Errorf("invalid JWT signature: %w", err)
+	}
+
+	// verify the claims
+	if !validIssuer(c.ssoBaseUrl, payload.Iss) {
+		return AccessTokenClaims{}, fmt.Errorf("unexpected JWT issuer '%s'", payload.Iss)
+	}
+	claims.Expires = time.Unix(payload.Exp, 0)
+	if time.Now().After(claims.Expires.Add(jwtLeeway)) {
+		return AccessTokenClaims{}, fmt.Errorf("access token expired at %s", claims.Expires)
+	}
+
+	// extract the character and scopes
+	claims.CharacterName = payload.Name
+	subParts := strings.Split(payload.Sub, ":")
+	if len(subParts) != 3 || subParts[0] != "CHARACTER" {
+		return AccessTokenClaims{}, fmt.Errorf("unexpected JWT subject '%s'", payload.Sub)
+	}
+	characterId, err := strconv.ParseInt(subParts[2], 10, 32)
+	if err != nil {
+		return AccessTokenClaims{}, fmt.Errorf("error parsing JWT subject: %w", err)
+	}
+	claims.CharacterId = int32(characterId)
+	claims.Scopes, err = parseJwtScopes(payload.Scp)
+	if err != nil {
+		return AccessTokenClaims{}, err
+	}
+
+	return claims, nil
+}
+
+func decodeJwtSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// 'scp' is a string when the token has a single scope, otherwise an array
+func parseJwtScopes(raw json.RawMessage) (scopes []string, err error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var scope string
+	if err = json.Unmarshal(raw, &scope); err == nil {
+		return []string{scope}, nil
+	}
+	if err = json.Unmarshal(raw, &scopes); err != nil {
+		return nil, fmt.Errorf("error parsing JWT scopes: %w", err)
+	}
+	return scopes, nil
+}
+
+// SSO issues tokens with either the bare host or the full URL as issuer
+func validIssuer(ssoBaseUrl string, issuer string) bool {
+	u, err := url.Parse(ssoBaseUrl)
+	if err != nil {
+		return false
+	}
+	return issuer == u.Host || issuer == fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwksCache struct {
+	SsoBaseUrl string    `json:"sso_base_url"`
+	FetchedAt  time.Time `json:"fetched_at"`
+	Jwks       jwks      `json:"jwks"`
+}
+
+// returns the RSA key with the given kid, using the cached JWKS document if it
+// is fresh and refetching it if the key is not found
+func (c *Client) getJwksKey(ctx context.Context, kid string) (key *rsa.PublicKey, err error) {
+	c.jwksMu.Lock()
+	defer c.jwksMu.Unlock()
+
+	cache, err := c.loadJwksCache()
+	if err == nil &&
+		cache.SsoBaseUrl == c.ssoBaseUrl &&
+		time.Since(cache.FetchedAt) < jwksCacheTtl {
+		if key, err = cache.Jwks.rsaKey(kid); err == nil {
+			return key, nil
+		}
+	}
+
+	document, err := c.fetchJwks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.writeJwksCache(jwksCache{
+		SsoBaseUrl: c.ssoBaseUrl,
+		FetchedAt:  time.Now(),
+		Jwks:       document,
+	})
+
+	return document.rsaKey(kid)
+}
+
+func (j jwks) rsaKey(kid string) (key *rsa.PublicKey, err error) {
+	for _, v := range j.Keys {
+		if v.Kid != kid || v.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(v.N)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding JWK modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(v.E)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding JWK exponent: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	}
+	return nil, fmt.Errorf("JWK '%s' not found", kid)
+}
+
+func (c *Client) fetchJwks(ctx context.Context) (document jwks, err error) {
+	// build the request
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"GET",
+		fmt.Sprintf("%s/oauth/jwks", strings.TrimSuffix(c.ssoBaseUrl, "/")),
+		nil,
+	)
+	if err != nil {
+		return jwks{}, err
+	}
+	addHeaderUserAgent(req)
+
+	// fetch the response
+	httpRep, close, err := c.doRequest(req)
+	if err != nil {
+		return jwks{}, err
+	}
+	defer close()
+
+	err = json.NewDecoder(httpRep.Body).Decode(&document)
+	if err != nil {
+		return jwks{}, err
+	}
+
+	return document, nil
+}
+
+// the document is kept in memory, and on disk if a cache file is configured
+func (c *Client) loadJwksCache() (cache jwksCache, err error) {
+	if c.jwks != nil {
+		return *c.jwks, nil
+	}
+	if c.jwksCacheFile == "" {
+		return jwksCache{}, fmt.Errorf("JWKS not cached")
+	}
+	data, err := os.ReadFile(c.jwksCacheFile)
+	if err != nil {
+		return jwksCache{}, err
+	}
+	err = json.Unmarshal(data, &cache)
+	if err != nil {
+		return jwksCache{}, err
+	}
+	c.jwks = &cache
+	return cache, nil
+}
+
+// failing to write the cache only costs a refetch next run
+func (c *Client) writeJwksCache(cache jwksCache) {
+	c.jwks = &cache
+	if c.jwksCacheFile == "" {
+		return
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return
+	}
+	if err = writeFileAtomic(c.jwksCacheFile, data, 0644); err != nil {
+		c.logger.Printf("error writing '%s': '%s'", c.jwksCacheFile, err)
+	}
+}
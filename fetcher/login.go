@@ -0,0 +1,213 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	loginTimeout = 5 * time.Minute
+	// how long in-flight callback requests get to finish once logged in
+	loginShutdownTimeout = 5 * time.Second
+)
+
+// every scope any dataset may need
+var DefaultScopes = []string{
+	"esi-assets.read_corporation_assets.v1",
+	"esi-corporations.read_blueprints.v1",
+	"esi-markets.structure_markets.v1",
+}
+
+type LoginOptions struct {
+	ClientId string
+	// empty for public clients
+	ClientSecret string
+	// a loopback URL registered with the application, listened on for the
+	// authorization code
+	CallbackUrl string
+	Scopes      []string
+	// shows the authorize URL to the user, defaults to printing it to stdout
+	Prompt func(authorizeUrl string)
+}
+
+// runs the SSO v2 authorization code flow with PKCE, receiving the code on a
+// loopback listener at callbackUrl
+func (c *Client) Login(
+	ctx context.Context,
+	opts LoginOptions,
+) (
+	refreshToken string,
+	err error,
+) {
+	callback, err := url.Parse(opts.CallbackUrl)
+	if err != nil {
+		return "", err
+	}
+	if callback.Path == "" {
+		callback.Path = "/"
+	}
+
+	verifier, challenge, err := newPkcePair()
+	if err != nil {
+		return "", err
+	}
+	state, err := randomUrlString(16)
+	if err != nil {
+		return "", err
+	}
+
+	// start the callback listener
+	listener, err := net.Listen("tcp", callback.Host)
+	if err != nil {
+		return "", err
+	}
+	// only the first result is waited for, later requests to the callback,
+	// e.g. browser retries, must not block on sending theirs
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	sendErr := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(callback.Path, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("state") != state {
+			http.Error(w, "state mismatch", http.StatusBadRequest)
+			sendErr(fmt.Errorf("login callback state mismatch"))
+			return
+		}
+		code := query.Get("code")
+		if code == "" {
+			http.Error(w, "missing code", http.StatusBadRequest)
+			sendErr(fmt.Errorf("login callback missing code"))
+			return
+		}
+		fmt.Fprintln(w, "Login complete, you may close this window.")
+		select {
+		case codes <- code:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			sendErr(err)
+		}
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(
+			context.Background(),
+			loginShutdownTimeout,
+		)
+		defer cancel()
+		if server.Shutdown(shutdownCtx) != nil {
+			server.Close()
+		}
+	}()
+
+	prompt := opts.Prompt
+	if prompt == nil {
+		prompt = func(authorizeUrl string) {
+			fmt.Printf(
+				"Open the following URL in your browser to log in:\n\n%s\n\n",
+				authorizeUrl,
+			)
+		}
+	}
+	prompt(authorizeUrl(
+		c.ssoBaseUrl,
+		opts.ClientId,
+		opts.CallbackUrl,
+		opts.Scopes,
+		challenge,
+		state,
+	))
+
+	// wait for the redirect
+	var code string
+	select {
+	case code = <-codes:
+	case err = <-errs:
+		return "", err
+	case <-time.After(loginTimeout):
+		return "", fmt.Errorf("timed out waiting for login callback")
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	// exchange the code
+	rep, err := c.postToken(
+		ctx,
+		opts.ClientId,
+		opts.ClientSecret,
+		fmt.Sprintf(
+			`grant_type=authorization_code&code=%s&code_verifier=%s`,
+			url.QueryEscape(code),
+			url.QueryEscape(verifier),
+		),
+	)
+	if err != nil {
+		return "", err
+	}
+	if rep.RefreshToken == "" {
+		return "", fmt.Errorf("token response missing refresh token")
+	}
+
+	return rep.RefreshToken, nil
+}
+
+func authorizeUrl(
+	ssoBaseUrl string,
+	clientId string,
+	callbackUrl string,
+	scopes []string,
+	challenge string,
+	state string,
+) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("redirect_uri", callbackUrl)
+	query.Set("client_id", clientId)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	query.Set("state", state)
+	return fmt.Sprintf(
+		"%s/v2/oauth/authorize?%s",
+		strings.TrimSuffix(ssoBaseUrl, "/"),
+		query.Encode(),
+	)
+}
+
+func newPkcePair() (
+	verifier string,
+	challenge string,
+	err error,
+) {
+	verifier, err = randomUrlString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func randomUrlString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
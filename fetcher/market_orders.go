@@ -0,0 +1,626 @@
+package fetcher
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	DatasetMarketOrders = "market_orders"
+	MarketOrdersFile    = "market_orders.json"
+)
+
+type MarketOrdersOptions struct {
+	// only used for structure orders, may be nil if LocationIds is empty
+	Tokens      TokenSource
+	RegionIds   []int32
+	LocationIds []int64
+	// if set, a region or structure that fails does not stop the others, and
+	// is reported by a *MissingOrdersError returned alongside the rest
+	KeepGoing bool
+	// if > 0, each book is truncated to its best levels covering this many
+	// units
+	Depth uint64
+	// if set, each level also lists its orders with their IDs, issue times,
+	// minimum volumes and ranges
+	Full bool
+}
+
+// the inputs recorded in the envelope and meta of outputs fetched with o
+func (o MarketOrdersOptions) Inputs() EnvelopeInputs {
+	return EnvelopeInputs{
+		RegionIds:   o.RegionIds,
+		LocationIds: o.LocationIds,
+		Depth:       o.Depth,
+		Full:        o.Full,
+	}
+}
+
+// the regions and structures left out of partial market orders
+type MissingOrders struct {
+	RegionIds   []int32 `json:"region_ids,omitempty"`
+	LocationIds []int64 `json:"location_ids,omitempty"`
+}
+
+func (c *Client) GetAndWriteMarketOrders(
+	ctx context.Context,
+	opts MarketOrdersOptions,
+	out OutputWriter,
+) error {
+	serializableLocationOrders, snapshot, fetchErr := c.GetSerializableLocationOrders(ctx, opts)
+	var missingErr *MissingOrdersError
+	if fetchErr != nil && !errors.As(fetchErr, &missingErr) {
+		return fetchErr
+	}
+	meta := OutputMeta{Snapshot: snapshot}
+	if missingErr != nil {
+		meta.Missing = &missingErr.Missing
+	}
+	inputs := opts.Inputs()
+	inputs.Missing = meta.Missing
+	envelope := newEnvelope(out, DatasetMarketOrders, snapshot, inputs)
+	var serializable Serializable = serializableLocationOrders
+	if opts.Full {
+		serializable = SerializableFullLocationOrders(serializableLocationOrders)
+	}
+	err := writeSerializable(out, MarketOrdersFile, serializable, envelope)
+	if err != nil {
+		return err
+	}
+	err = out.writeSinks(ctx, DatasetMarketOrders, serializable, snapshot)
+	if err != nil {
+		return err
+	}
+	err = writeOutputMeta(out, MarketOrdersFile, meta, inputs)
+	if err != nil {
+		return err
+	}
+	return fetchErr
+}
+
+func (c *Client) GetSerializableLocationOrders(
+	ctx context.Context,
+	opts MarketOrdersOptions,
+) (
+	serializableLocationOrders SerializableLocationOrders,
+	snapshot Snapshot,
+	err error,
+) {
+	regionOrders, structureOrders, snapshot, err := c.GetOrders(ctx, opts)
+	var missingErr *MissingOrdersError
+	if err != nil && !errors.As(err, &missingErr) {
+		return nil, Snapshot{}, err
+	}
+	serializableLocationOrders = OrdersToSerializable(regionOrders, structureOrders)
+	serializableLocationOrders.Truncate(opts.Depth)
+	if !opts.Full {
+		serializableLocationOrders.Compact()
+	}
+	return serializableLocationOrders, snapshot, err
+}
+
+func (c *Client) GetOrders(
+	ctx context.Context,
+	opts MarketOrdersOptions,
+) (
+	regionOrders [][]OrdersRegionEntry,
+	structureOrders map[int64][]OrdersStructureEntry,
+	snapshot Snapshot,
+	err error,
+) {
+	regionIds, locationIds := opts.RegionIds, opts.LocationIds
+
+	// stops the remaining fetches once one fails, unless keeping going
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chnRegion := make(chan GetOrdersResult[OrdersRegionEntry, int32], len(regionIds))
+	for _, v := range regionIds {
+		go func(v int32) {
+			orders, snapshot, err := c.GetRegionOrders(ctx, v)
+			chnRegion <- GetOrdersResult[OrdersRegionEntry, int32]{
+				Id:       v,
+				Model:    orders,
+				Snapshot: snapshot,
+				Err:      err,
+			}
+		}(v)
+	}
+
+	chnStructure := make(chan GetOrdersResult[OrdersStructureEntry, int64], len(locationIds))
+	for _, v := range locationIds {
+		go func(v int64) {
+			orders, snapshot, err := c.GetStructureOrders(ctx, opts.Tokens, v)
+			chnStructure <- GetOrdersResult[OrdersStructureEntry, int64]{
+				Id:       v,
+				Model:    orders,
+				Snapshot: snapshot,
+				Err:      err,
+			}
+		}(v)
+	}
+
+	// the channels are buffered, so unreceived results do not leak goroutines
+	regionOrders = make([][]OrdersRegionEntry, 0, len(regionIds))
+	structureOrders = make(map[int64][]OrdersStructureEntry, len(locationIds))
+	var missing MissingOrders
+	var errs []error
+	for i := 0; i < len(regionIds)+len(locationIds); i++ {
+		select {
+		case pageResult := <-chnRegion:
+			if pageResult.Err != nil && !opts.KeepGoing {
+				return nil, nil, Snapshot{}, pageResult.Err
+			} else if pageResult.Err != nil {
+				missing.RegionIds = append(missing.RegionIds, pageResult.Id)
+				errs = append(errs, fmt.Errorf("region %d: %w", pageResult.Id, pageResult.Err))
+				continue
+			}
+			regionOrders = append(regionOrders, pageResult.Model)
+			snapshot = snapshot.Combine(pageResult.Snapshot)
+		case pageResult := <-chnStructure:
+			if pageResult.Err != nil && !opts.KeepGoing {
+				return nil, nil, Snapshot{}, pageResult.Err
+			} else if pageResult.Err != nil {
+				missing.LocationIds = append(missing.LocationIds, pageResult.Id)
+				errs = append(errs, fmt.Errorf("structure %d: %w", pageResult.Id, pageResult.Err))
+				continue
+			}
+			structureOrders[pageResult.Id] = pageResult.Model
+			snapshot = snapshot.Combine(pageResult.Snapshot)
+		}
+	}
+
+	// every source failing is not a partial result
+	if len(errs) == len(regionIds)+len(locationIds) && len(errs) > 0 {
+		return nil, nil, Snapshot{}, errors.Join(errs...)
+	} else if len(errs) > 0 {
+		return regionOrders, structureOrders, snapshot, &MissingOrdersError{
+			Missing: missing,
+			Errs:    errs,
+		}
+	}
+
+	return regionOrders, structureOrders, snapshot, nil
+}
+
+type GetOrdersResult[E any, ID any] struct {
+	Id       ID
+	Model    []E
+	Snapshot Snapshot
+	Err      error
+}
+
+func (c *Client) GetStructureOrders(
+	ctx context.Context,
+	tokens TokenSource,
+	locationId int64,
+) (
+	orders []OrdersStructureEntry,
+	snapshot Snapshot,
+	err error,
+) {
+	return getAllPages[OrdersStructureEntry](
+		ctx,
+		c,
+		c.esi.url(
+			"/markets/structures/%d/",
+			locationId,
+		),
+		tokens,
+	)
+}
+
+// region orders are public and need no tokens
+func (c *Client) GetRegionOrders(
+	ctx context.Context,
+	regionId int32,
+) (
+	orders []OrdersRegionEntry,
+	snapshot Snapshot,
+	err error,
+) {
+	return getAllPages[OrdersRegionEntry](
+		ctx,
+		c,
+		c.esi.url(
+			"/markets/%d/orders/",
+			regionId,
+		),
+		nil,
+	)
+}
+
+type OrdersRegionEntry struct {
+	Duration     int32     `json:"duration"`
+	IsBuyOrder   bool      `json:"is_buy_order"`
+	Issued       time.Time `json:"issued"`
+	LocationId   int64     `json:"location_id"`
+	MinVolume    int32     `json:"min_volume"`
+	OrderId      int64     `json:"order_id"`
+	Price        float64   `json:"price"`
+	Range        string    `json:"range"`
+	SystemId     int32     `json:"system_id"`
+	TypeId       int32     `json:"type_id"`
+	VolumeRemain int32     `json:"volume_remain"`
+	VolumeTotal  int32     `json:"volume_total"`
+}
+
+func (e OrdersRegionEntry) serializable() SerializableOrder {
+	return SerializableOrder{
+		OrderId:     e.OrderId,
+		Volume:      uint64(e.VolumeRemain),
+		VolumeTotal: uint64(e.VolumeTotal),
+		MinVolume:   uint64(e.MinVolume),
+		Issued:      e.Issued,
+		Duration:    e.Duration,
+		Range:       e.Range,
+		SystemId:    e.SystemId,
+	}
+}
+
+type OrdersStructureEntry struct {
+	Duration     int32     `json:"duration"`
+	IsBuyOrder   bool      `json:"is_buy_order"`
+	Issued       time.Time `json:"issued"`
+	MinVolume    int32     `json:"min_volume"`
+	OrderId      int64     `json:"order_id"`
+	Price        float64   `json:"price"`
+	Range        string    `json:"range"`
+	TypeId       int32     `json:"type_id"`
+	VolumeRemain int32     `json:"volume_remain"`
+	VolumeTotal  int32     `json:"volume_total"`
+}
+
+func (e OrdersStructureEntry) serializable() SerializableOrder {
+	return SerializableOrder{
+		OrderId:     e.OrderId,
+		Volume:      uint64(e.VolumeRemain),
+		VolumeTotal: uint64(e.VolumeTotal),
+		MinVolume:   uint64(e.MinVolume),
+		Issued:      e.Issued,
+		Duration:    e.Duration,
+		Range:       e.Range,
+	}
+}
+
+// a single order of a level, only kept in full outputs
+type SerializableOrder struct {
+	OrderId int64 `json:"order_id"`
+	// the volume remaining
+	Volume      uint64    `json:"volume"`
+	VolumeTotal uint64    `json:"volume_total"`
+	MinVolume   uint64    `json:"min_volume"`
+	Issued      time.Time `json:"issued"`
+	// in days
+	Duration int32  `json:"duration"`
+	Range    string `json:"range"`
+	// 0 for structure orders, ESI does not report their system
+	SystemId int32 `json:"system_id,omitempty"`
+}
+
+// the orders at one price on one side of a type's market
+type SerializableLevel struct {
+	Price  float64 `json:"price"`
+	Volume uint64  `json:"volume"`
+	Orders int     `json:"orders"`
+	// nil unless the output is full
+	Entries []SerializableOrder `json:"entries,omitempty"`
+}
+
+// one side of a type's market, best price first
+type SerializableBook struct {
+	Levels []SerializableLevel `json:"levels"`
+	// the volume of the whole book, including levels left out by truncation
+	Total uint64 `json:"total"`
+}
+
+// appends an order as a level of its own, aggregate sorts and merges them
+// once every order is added
+func (b *SerializableBook) add(price float64, order SerializableOrder) {
+	b.Levels = append(b.Levels, SerializableLevel{
+		Price:   price,
+		Volume:  order.Volume,
+		Orders:  1,
+		Entries: []SerializableOrder{order},
+	})
+	b.Total += order.Volume
+}
+
+// sorts the levels ascending, or descending for buy orders, merging those at
+// the same price
+func (b *SerializableBook) aggregate(descending bool) {
+	slices.SortStableFunc(b.Levels, func(x, y SerializableLevel) int {
+		if descending {
+			return cmp.Compare(y.Price, x.Price)
+		}
+		return cmp.Compare(x.Price, y.Price)
+	})
+
+	levels := b.Levels[:0]
+	for _, level := range b.Levels {
+		if n := len(levels); n > 0 && levels[n-1].Price == level.Price {
+			last := &levels[n-1]
+			last.Volume += level.Volume
+			last.Orders += level.Orders
+			last.Entries = append(last.Entries, level.Entries...)
+			continue
+		}
+		levels = append(levels, level)
+	}
+	b.Levels = levels
+}
+
+// drops the levels past the best ones covering depth units, the book is left
+// whole if depth is 0 or more than it holds
+func (b *SerializableBook) truncate(depth uint64) {
+	if depth == 0 {
+		return
+	}
+	var covered uint64
+	for i, level := range b.Levels {
+		covered += level.Volume
+		if covered >= depth {
+			b.Levels = b.Levels[:i+1]
+			return
+		}
+	}
+}
+
+type SerializableTypeOrders struct {
+	Sell SerializableBook `json:"sell"`
+	Buy  SerializableBook `json:"buy"`
+	// the IDs of the orders added to either book
+	orderIds map[int64]struct{}
+}
+
+func newSerializableTypeOrders() *SerializableTypeOrders {
+	return &SerializableTypeOrders{
+		Sell:     SerializableBook{Levels: []SerializableLevel{}},
+		Buy:      SerializableBook{Levels: []SerializableLevel{}},
+		orderIds: make(map[int64]struct{}),
+	}
+}
+
+// adds an order unless it was already added, as region orders include those
+// in public structures, which are fetched again when listed in LocationIds
+func (t *SerializableTypeOrders) add(isBuyOrder bool, price float64, order SerializableOrder) {
+	if _, ok := t.orderIds[order.OrderId]; ok {
+		return
+	}
+	if t.orderIds == nil {
+		t.orderIds = make(map[int64]struct{})
+	}
+	t.orderIds[order.OrderId] = struct{}{}
+
+	if isBuyOrder {
+		t.Buy.add(price, order)
+	} else {
+		t.Sell.add(price, order)
+	}
+}
+
+type SerializableOrders map[int32]*SerializableTypeOrders
+
+type SerializableLocationOrders map[int64]SerializableOrders
+
+// sorts every book best price first and aggregates orders at the same price
+// into levels, needed after adding orders with WithRegionOrders or
+// WithStructureOrders
+func (s SerializableLocationOrders) Aggregate() {
+	for _, serializableOrders := range s {
+		for _, typeOrders := range serializableOrders {
+			typeOrders.Sell.aggregate(false)
+			typeOrders.Buy.aggregate(true)
+		}
+	}
+}
+
+// truncates every book to its best levels covering depth units, leaving them
+// whole if depth is 0
+func (s SerializableLocationOrders) Truncate(depth uint64) {
+	for _, serializableOrders := range s {
+		for _, typeOrders := range serializableOrders {
+			typeOrders.Sell.truncate(depth)
+			typeOrders.Buy.truncate(depth)
+		}
+	}
+}
+
+// drops the orders listed in each level, leaving the compact output
+func (s SerializableLocationOrders) Compact() {
+	for _, serializableOrders := range s {
+		for _, typeOrders := range serializableOrders {
+			for _, book := range []*SerializableBook{&typeOrders.Sell, &typeOrders.Buy} {
+				for i := range book.Levels {
+					book.Levels[i].Entries = nil
+				}
+			}
+		}
+	}
+}
+
+// writes the data with every encoder of out
+func (s SerializableLocationOrders) Write(out OutputWriter, envelope *Envelope) error {
+	return writeSerializable(out, MarketOrdersFile, s, envelope)
+}
+
+func (s SerializableLocationOrders) Columns() []string {
+	return []string{"location_id", "type_id", "is_buy_order", "price", "volume", "orders"}
+}
+
+func (s SerializableLocationOrders) Rows() [][]any {
+	rows := make([][]any, 0, len(s))
+	for _, locationId := range sortedKeys(s) {
+		serializableOrders := s[locationId]
+		for _, typeId := range sortedKeys(serializableOrders) {
+			typeOrders := serializableOrders[typeId]
+			for _, v := range typeOrders.Sell.Levels {
+				rows = append(rows, []any{locationId, typeId, false, v.Price, v.Volume, v.Orders})
+			}
+			for _, v := range typeOrders.Buy.Levels {
+				rows = append(rows, []any{locationId, typeId, true, v.Price, v.Volume, v.Orders})
+			}
+		}
+	}
+	return rows
+}
+
+func (s SerializableLocationOrders) Counts() map[string]int {
+	counts := map[string]int{"locations": len(s)}
+	for _, serializableOrders := range s {
+		counts["types"] += len(serializableOrders)
+		for _, typeOrders := range serializableOrders {
+			counts["sell_levels"] += len(typeOrders.Sell.Levels)
+			counts["buy_levels"] += len(typeOrders.Buy.Levels)
+			for _, level := range typeOrders.Sell.Levels {
+				counts["sell_orders"] += level.Orders
+			}
+			for _, level := range typeOrders.Buy.Levels {
+				counts["buy_orders"] += level.Orders
+			}
+		}
+	}
+	return counts
+}
+
+func OrdersToSerializable(
+	regionOrders [][]OrdersRegionEntry,
+	structureOrders map[int64][]OrdersStructureEntry,
+) SerializableLocationOrders {
+	serializableLocationOrders := make(SerializableLocationOrders)
+	for _, v := range regionOrders {
+		WithRegionOrders(serializableLocationOrders, v)
+	}
+	for k, v := range structureOrders {
+		WithStructureOrders(serializableLocationOrders, v, k)
+	}
+	serializableLocationOrders.Aggregate()
+	return serializableLocationOrders
+}
+
+func WithRegionOrders(
+	serializableLocationOrders map[int64]SerializableOrders,
+	orders []OrdersRegionEntry,
+) {
+	for _, v := range orders {
+		withOrder(
+			serializableLocationOrders,
+			v.LocationId,
+			v.TypeId,
+			v.IsBuyOrder,
+			v.Price,
+			v.serializable(),
+		)
+	}
+}
+
+func WithStructureOrders(
+	serializableLocationOrders map[int64]SerializableOrders,
+	orders []OrdersStructureEntry,
+	locationId int64,
+) {
+	for _, v := range orders {
+		withOrder(
+			serializableLocationOrders,
+			locationId,
+			v.TypeId,
+			v.IsBuyOrder,
+			v.Price,
+			v.serializable(),
+		)
+	}
+}
+
+// adds an order to the buy or sell book of its location and type
+func withOrder(
+	serializableLocationOrders map[int64]SerializableOrders,
+	locationId int64,
+	typeId int32,
+	isBuyOrder bool,
+	price float64,
+	order SerializableOrder,
+) {
+	if order.Volume == 0 {
+		return
+	}
+
+	serializableOrders, ok := serializableLocationOrders[locationId]
+	if !ok {
+		serializableOrders = SerializableOrders{}
+		serializableLocationOrders[locationId] = serializableOrders
+	}
+
+	serializableTypeOrders, ok := serializableOrders[typeId]
+	if !ok {
+		serializableTypeOrders = newSerializableTypeOrders()
+		serializableOrders[typeId] = serializableTypeOrders
+	}
+
+	serializableTypeOrders.add(isBuyOrder, price, order)
+}
+
+// the same data as SerializableLocationOrders with each level's orders listed,
+// its rows are single orders rather than levels
+type SerializableFullLocationOrders SerializableLocationOrders
+
+func (s SerializableFullLocationOrders) Columns() []string {
+	return []string{
+		"location_id",
+		"type_id",
+		"is_buy_order",
+		"price",
+		"order_id",
+		"volume",
+		"volume_total",
+		"min_volume",
+		"issued",
+		"duration",
+		"range",
+		"system_id",
+	}
+}
+
+func (s SerializableFullLocationOrders) Rows() [][]any {
+	rows := make([][]any, 0, len(s))
+	for _, locationId := range sortedKeys(s) {
+		serializableOrders := s[locationId]
+		for _, typeId := range sortedKeys(serializableOrders) {
+			typeOrders := serializableOrders[typeId]
+			for _, book := range []struct {
+				isBuyOrder bool
+				levels     []SerializableLevel
+			}{
+				{false, typeOrders.Sell.Levels},
+				{true, typeOrders.Buy.Levels},
+			} {
+				for _, level := range book.levels {
+					for _, v := range level.Entries {
+						rows = append(rows, []any{
+							locationId,
+							typeId,
+							book.isBuyOrder,
+							level.Price,
+							v.OrderId,
+							v.Volume,
+							v.VolumeTotal,
+							v.MinVolume,
+							v.Issued,
+							v.Duration,
+							v.Range,
+							v.SystemId,
+						})
+					}
+				}
+			}
+		}
+	}
+	return rows
+}
+
+func (s SerializableFullLocationOrders) Counts() map[string]int {
+	return SerializableLocationOrders(s).Counts()
+}
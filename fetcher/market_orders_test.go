@@ -0,0 +1,149 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetOrdersStopsRemainingRegionsAfterAnError(t *testing.T) {
+	const failingRegion = "666"
+	slowRegions := []int32{10000002, 10000043}
+
+	// the failing region only responds once every other region is in flight
+	var started sync.WaitGroup
+	started.Add(len(slowRegions))
+	cancelled := make(chan string, len(slowRegions))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		region := strings.Split(strings.TrimPrefix(r.URL.Path, "/latest/markets/"), "/")[0]
+		if region == failingRegion {
+			started.Wait()
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		started.Done()
+		select {
+		case <-r.Context().Done():
+			cancelled <- region
+		case <-time.After(10 * time.Second):
+		}
+	})
+
+	c, _ := newTestClient(t, handler)
+	goroutines := runtime.NumGoroutine()
+
+	_, _, _, err := c.GetOrders(context.Background(), MarketOrdersOptions{
+		RegionIds: append(slowRegions, 666),
+	})
+	var statusErr StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got error %v, expected status %d", err, http.StatusServiceUnavailable)
+	}
+
+	for range slowRegions {
+		select {
+		case <-cancelled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("a region still in flight was not cancelled")
+		}
+	}
+
+	// idle connections hold goroutines on both ends until closed
+	c.httpClient.CloseIdleConnections()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > goroutines {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf(
+				"%d goroutines still running, started with %d:\n%s",
+				runtime.NumGoroutine(),
+				goroutines,
+				buf[:runtime.Stack(buf, true)],
+			)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOrdersToSerializableSortsAndAggregatesBooks(t *testing.T) {
+	const locationId, typeId = 60003760, 34
+	regionOrders := [][]OrdersRegionEntry{{
+		{OrderId: 1, LocationId: locationId, TypeId: typeId, Price: 6, VolumeRemain: 10},
+		{OrderId: 2, LocationId: locationId, TypeId: typeId, Price: 5, VolumeRemain: 20},
+		{OrderId: 3, LocationId: locationId, TypeId: typeId, Price: 4, VolumeRemain: 5, IsBuyOrder: true},
+	}, {
+		{OrderId: 4, LocationId: locationId, TypeId: typeId, Price: 5, VolumeRemain: 30},
+		{OrderId: 5, LocationId: locationId, TypeId: typeId, Price: 4.5, VolumeRemain: 7, IsBuyOrder: true},
+		{OrderId: 6, LocationId: locationId, TypeId: typeId, Price: 4, VolumeRemain: 1, IsBuyOrder: true},
+	}}
+
+	typeOrders := OrdersToSerializable(regionOrders, nil)[locationId][typeId]
+
+	checkLevels := func(side string, book SerializableBook, expected []SerializableLevel, total uint64) {
+		t.Helper()
+		if book.Total != total {
+			t.Errorf("%s: got total %d, expected %d", side, book.Total, total)
+		}
+		if len(book.Levels) != len(expected) {
+			t.Fatalf("%s: got levels %+v, expected %+v", side, book.Levels, expected)
+		}
+		for i, level := range book.Levels {
+			if level.Price != expected[i].Price ||
+				level.Volume != expected[i].Volume ||
+				level.Orders != expected[i].Orders ||
+				len(level.Entries) != expected[i].Orders {
+				t.Errorf("%s: got level %+v, expected %+v", side, level, expected[i])
+			}
+		}
+	}
+	checkLevels("sell", typeOrders.Sell, []SerializableLevel{
+		{Price: 5, Volume: 50, Orders: 2},
+		{Price: 6, Volume: 10, Orders: 1},
+	}, 60)
+	checkLevels("buy", typeOrders.Buy, []SerializableLevel{
+		{Price: 4.5, Volume: 7, Orders: 1},
+		{Price: 4, Volume: 6, Orders: 2},
+	}, 13)
+}
+
+func TestOrdersToSerializableAddsStructureOrdersInRegionsOnce(t *testing.T) {
+	const structureId, typeId = 1035466617946, 34
+	regionOrders := [][]OrdersRegionEntry{{
+		{OrderId: 1, LocationId: structureId, TypeId: typeId, Price: 5, VolumeRemain: 10, SystemId: 30000142},
+		{OrderId: 2, LocationId: structureId, TypeId: typeId, Price: 4, VolumeRemain: 3, IsBuyOrder: true},
+	}}
+	structureOrders := map[int64][]OrdersStructureEntry{structureId: {
+		{OrderId: 1, TypeId: typeId, Price: 5, VolumeRemain: 10},
+		{OrderId: 2, TypeId: typeId, Price: 4, VolumeRemain: 3, IsBuyOrder: true},
+		{OrderId: 3, TypeId: typeId, Price: 5, VolumeRemain: 7},
+	}}
+
+	typeOrders := OrdersToSerializable(regionOrders, structureOrders)[structureId][typeId]
+
+	for _, test := range []struct {
+		side   string
+		book   SerializableBook
+		orders int
+		total  uint64
+	}{
+		{"sell", typeOrders.Sell, 2, 17},
+		{"buy", typeOrders.Buy, 1, 3},
+	} {
+		if test.book.Total != test.total {
+			t.Errorf("%s: got total %d, expected %d", test.side, test.book.Total, test.total)
+		}
+		if len(test.book.Levels) != 1 || test.book.Levels[0].Orders != test.orders {
+			t.Errorf("%s: got levels %+v, expected 1 level of %d orders", test.side, test.book.Levels, test.orders)
+		}
+	}
+	// the region's copy of an order is kept, it also reports the system
+	if systemId := typeOrders.Sell.Levels[0].Entries[0].SystemId; systemId != 30000142 {
+		t.Errorf("got system %d, expected the region order's 30000142", systemId)
+	}
+}
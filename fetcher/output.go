@@ -0,0 +1,160 @@
+package fetcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	historyDir = "history"
+	// sorts chronologically, and is safe in file names on every platform
+	historyTimeFormat = "20060102T150405.000000000Z"
+)
+
+// writes output files atomically into Dir, so that readers never observe a
+// partially written file
+type OutputWriter struct {
+	// created if needed, the working directory if empty
+	Dir string
+	// if > 0, every write is kept as 'history/<name>/<time><ext>' under Dir,
+	// with ext every extension of name, e.g. '.json.gz', the newest History copies of each file are retained, and 'Dir/<name>'
+	// is a symlink pointing at the latest copy
+	History int
+	// if set, outputs are wrapped in an Envelope
+	Envelope bool
+	// each output is written once per encoder, defaults to DefaultEncoders
+	Encoders []Encoder
+	// receive every output in addition to its files
+	Sinks []Sink
+}
+
+// stores outputs somewhere other than files, e.g. a database
+type Sink interface {
+	// dataset is one of the Dataset* constants, which determines the type
+	// of s
+	WriteDataset(
+		ctx context.Context,
+		dataset string,
+		s Serializable,
+		snapshot Snapshot,
+	) error
+}
+
+func (w OutputWriter) writeSinks(
+	ctx context.Context,
+	dataset string,
+	s Serializable,
+	snapshot Snapshot,
+) error {
+	for _, sink := range w.Sinks {
+		if err := sink.WriteDataset(ctx, dataset, s, snapshot); err != nil {
+			return &WriteError{Path: dataset, Err: err}
+		}
+	}
+	return nil
+}
+
+func (w OutputWriter) encoders() []Encoder {
+	if len(w.Encoders) == 0 {
+		return DefaultEncoders
+	}
+	return w.Encoders
+}
+
+// the names of the files an output named name is written as
+func (w OutputWriter) EncodedNames(name string) []string {
+	names := make([]string, 0, len(w.encoders()))
+	for _, encoder := range w.encoders() {
+		names = append(names, encodedName(name, encoder))
+	}
+	return names
+}
+
+func (w OutputWriter) Path(name string) string {
+	return filepath.Join(w.Dir, name)
+}
+
+func (w OutputWriter) Write(name string, data []byte) error {
+	path := w.Path(name)
+	if w.Dir != "" {
+		if err := os.MkdirAll(w.Dir, 0755); err != nil {
+			return &WriteError{Path: path, Err: err}
+		}
+	}
+
+	if w.History <= 0 {
+		if err := writeFileAtomic(path, data, 0644); err != nil {
+			return &WriteError{Path: path, Err: err}
+		}
+		return nil
+	}
+
+	// write the copy, then point the latest pointer at it
+	// each encoding of an output keeps its own copies, so that pruning one
+	// never removes the copy another's symlink points at
+	copyDir := filepath.Join(historyDir, name)
+	copyName := filepath.Join(copyDir, time.Now().UTC().Format(historyTimeFormat)+fullExt(name))
+	if err := os.MkdirAll(w.Path(copyDir), 0755); err != nil {
+		return &WriteError{Path: w.Path(copyName), Err: err}
+	}
+	if err := writeFileAtomic(w.Path(copyName), data, 0644); err != nil {
+		return &WriteError{Path: w.Path(copyName), Err: err}
+	}
+	if err := symlinkAtomic(copyName, path); err != nil {
+		return &WriteError{Path: path, Err: err}
+	}
+
+	return w.prune(copyDir)
+}
+
+// removes all but the newest History copies in copyDir
+func (w OutputWriter) prune(copyDir string) error {
+	entries, err := os.ReadDir(w.Path(copyDir))
+	if err != nil {
+		return &WriteError{Path: w.Path(copyDir), Err: err}
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		// skip temp files of concurrent writes
+		if !entry.IsDir() && !strings.Contains(entry.Name(), ".tmp") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for i := 0; i < len(names)-w.History; i++ {
+		path := filepath.Join(w.Path(copyDir), names[i])
+		if err := os.Remove(path); err != nil {
+			return &WriteError{Path: path, Err: err}
+		}
+	}
+	return nil
+}
+
+// every extension of name, e.g. '.json.gz'
+func fullExt(name string) string {
+	base := filepath.Base(name)
+	if i := strings.Index(base, "."); i >= 0 {
+		return base[i:]
+	}
+	return ""
+}
+
+// creates a symlink to target in a temp file and renames it over path, so
+// readers always find either the previous or the new target
+func symlinkAtomic(target string, path string) error {
+	tmp := path + ".tmp" + time.Now().Format("150405.000000000")
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
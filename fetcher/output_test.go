@@ -0,0 +1,38 @@
+package fetcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputWriterKeepsHistoryPerFormat(t *testing.T) {
+	out := OutputWriter{
+		Dir:      t.TempDir(),
+		History:  1,
+		Encoders: []Encoder{JsonEncoder{}, CsvEncoder{}, GzipEncoder{JsonEncoder{}}},
+	}
+
+	for _, price := range []float64{10.5, 11} {
+		adjustedPrices := SerializableAdjustedPrices{34: price}
+		if err := adjustedPrices.Write(out, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range out.EncodedNames(AdjustedPricesFile) {
+		if _, err := os.Stat(out.Path(name)); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+		copies, err := filepath.Glob(out.Path(filepath.Join(historyDir, name, "*")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(copies) != 1 {
+			t.Errorf("%s: got history copies %v, expected 1", name, copies)
+		} else if !strings.HasSuffix(copies[0], fullExt(name)) {
+			t.Errorf("%s: got history copy '%s', expected extension '%s'", name, copies[0], fullExt(name))
+		}
+	}
+}
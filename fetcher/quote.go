@@ -0,0 +1,159 @@
+package fetcher
+
+type QuoteOptions struct {
+	// locations to quote at, every location with orders if empty
+	LocationIds []int64
+	// if set, quotes selling into buy orders instead of buying from sell
+	// orders
+	Sell bool
+}
+
+// an item of a bill of materials
+type QuoteItem struct {
+	TypeId   int32  `json:"type_id"`
+	Quantity uint64 `json:"quantity"`
+}
+
+// the cost of filling an item from one location's book
+//
+// books truncated with MarketOrdersOptions.Depth may fill less than they
+// would in full, and only full books let orders whose minimum volume cannot
+// be met be skipped
+type Quote struct {
+	TypeId int32 `json:"type_id"`
+	// 0 if no location has orders for the type
+	LocationId int64  `json:"location_id"`
+	Quantity   uint64 `json:"quantity"`
+	Filled     uint64 `json:"filled"`
+	// the proceeds when selling
+	TotalCost float64 `json:"total_cost"`
+	// 0 if nothing was filled
+	AveragePrice float64 `json:"average_price"`
+	// the price of the last unit filled, 0 if nothing was filled
+	MarginalPrice float64 `json:"marginal_price"`
+	FillPercent   float64 `json:"fill_percent"`
+	// the levels consumed best price first, each with the units taken from it
+	// and the number of orders taken from
+	Levels []SerializableLevel `json:"levels"`
+}
+
+func (q Quote) Complete() bool { return q.Filled >= q.Quantity }
+
+// the quotes of every item of a bill of materials
+type BillQuote struct {
+	Quotes    []Quote `json:"quotes"`
+	TotalCost float64 `json:"total_cost"`
+	// false if any item could not be filled in full
+	Complete bool `json:"complete"`
+}
+
+// walks the book best price first until quantity units are filled or the book
+// runs out
+func (b SerializableBook) Fill(quantity uint64) (quote Quote) {
+	quote = Quote{Quantity: quantity, Levels: []SerializableLevel{}}
+	for _, level := range b.Levels {
+		if quote.Filled >= quantity {
+			break
+		}
+		taken, orders := level.take(quantity - quote.Filled)
+		if taken == 0 {
+			continue
+		}
+		quote.Filled += taken
+		quote.TotalCost += float64(taken) * level.Price
+		quote.MarginalPrice = level.Price
+		quote.Levels = append(quote.Levels, SerializableLevel{
+			Price:  level.Price,
+			Volume: taken,
+			Orders: orders,
+		})
+	}
+	if quote.Filled > 0 {
+		quote.AveragePrice = quote.TotalCost / float64(quote.Filled)
+	}
+	if quantity > 0 {
+		quote.FillPercent = 100 * float64(quote.Filled) / float64(quantity)
+	} else {
+		quote.FillPercent = 100
+	}
+	return quote
+}
+
+// returns how many of remaining units the level can fill and from how many
+// orders, skipping listed orders whose minimum volume exceeds what is left
+func (l SerializableLevel) take(remaining uint64) (taken uint64, orders int) {
+	if l.Entries == nil {
+		return min(l.Volume, remaining), l.Orders
+	}
+	for _, entry := range l.Entries {
+		if taken >= remaining {
+			break
+		} else if entry.MinVolume > remaining-taken {
+			continue
+		}
+		taken += min(entry.Volume, remaining-taken)
+		orders++
+	}
+	return taken, orders
+}
+
+// quotes quantity units of typeId at the location filling the most of them,
+// and of those the cheapest, or the most lucrative when selling
+func (s SerializableLocationOrders) Quote(
+	typeId int32,
+	quantity uint64,
+	opts QuoteOptions,
+) (quote Quote) {
+	locationIds := opts.LocationIds
+	if len(locationIds) == 0 {
+		locationIds = sortedKeys(s)
+	}
+
+	quote = Quote{TypeId: typeId, Quantity: quantity, Levels: []SerializableLevel{}}
+	if quantity == 0 {
+		quote.FillPercent = 100
+	}
+	found := false
+	for _, locationId := range locationIds {
+		typeOrders, ok := s[locationId][typeId]
+		if !ok {
+			continue
+		}
+
+		book := typeOrders.Sell
+		if opts.Sell {
+			book = typeOrders.Buy
+		}
+		candidate := book.Fill(quantity)
+		candidate.TypeId, candidate.LocationId = typeId, locationId
+
+		if !found || candidate.betterThan(quote, opts.Sell) {
+			quote, found = candidate, true
+		}
+	}
+	return quote
+}
+
+func (q Quote) betterThan(other Quote, sell bool) bool {
+	if q.Filled != other.Filled {
+		return q.Filled > other.Filled
+	} else if sell {
+		return q.TotalCost > other.TotalCost
+	}
+	return q.TotalCost < other.TotalCost
+}
+
+// quotes every item of a bill of materials, each at its own best location
+func (s SerializableLocationOrders) QuoteBill(
+	items []QuoteItem,
+	opts QuoteOptions,
+) (billQuote BillQuote) {
+	billQuote = BillQuote{Quotes: make([]Quote, 0, len(items)), Complete: true}
+	for _, item := range items {
+		quote := s.Quote(item.TypeId, item.Quantity, opts)
+		billQuote.Quotes = append(billQuote.Quotes, quote)
+		billQuote.TotalCost += quote.TotalCost
+		billQuote.Complete = billQuote.Complete && quote.Complete()
+	}
+	return billQuote
+}
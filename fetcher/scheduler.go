@@ -0,0 +1,80 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+const (
+	defaultMaxInFlight        = 50
+	defaultMaxInFlightPerHost = 20
+)
+
+// bounds the number of requests in flight, both in total and per host, across
+// every dataset being fetched
+type requestScheduler struct {
+	global       chan struct{}
+	maxPerHost   int
+	mu           sync.Mutex
+	perHostSlots map[string]chan struct{}
+}
+
+func newRequestScheduler(maxInFlight int, maxInFlightPerHost int) *requestScheduler {
+	return &requestScheduler{
+		global:       make(chan struct{}, maxInFlight),
+		maxPerHost:   maxInFlightPerHost,
+		perHostSlots: make(map[string]chan struct{}),
+	}
+}
+
+// a transport whose connection pool is sized to match the scheduler
+func newPooledTransport(maxInFlightPerHost int) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxConnsPerHost = maxInFlightPerHost
+	transport.MaxIdleConnsPerHost = maxInFlightPerHost
+	return transport
+}
+
+// blocks until a slot for host is free or ctx is done, returning a function
+// that frees it
+func (s *requestScheduler) acquire(ctx context.Context, host string) (
+	release func(),
+	err error,
+) {
+	hostSlots := s.hostSlots(host)
+
+	// always acquire the host slot first so that waiters for a busy host do
+	// not hold global slots
+	select {
+	case hostSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case s.global <- struct{}{}:
+	case <-ctx.Done():
+		<-hostSlots
+		return nil, ctx.Err()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-s.global
+			<-hostSlots
+		})
+	}, nil
+}
+
+func (s *requestScheduler) hostSlots(host string) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slots, ok := s.perHostSlots[host]
+	if !ok {
+		slots = make(chan struct{}, s.maxPerHost)
+		s.perHostSlots[host] = slots
+	}
+	return slots
+}
@@ -0,0 +1,85 @@
+package fetcher
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// access tokens are refreshed this long before they expire
+const tokenRefreshMargin = 60 * time.Second
+
+// supplies access tokens to requests for authenticated routes
+type TokenSource interface {
+	Token(ctx context.Context) (accessToken string, err error)
+	// called after ESI rejects accessToken
+	Invalidate(accessToken string)
+}
+
+// always hands out the same access token, e.g. a placeholder when replaying
+// fixtures
+type StaticTokenSource string
+
+func (s StaticTokenSource) Token(ctx context.Context) (accessToken string, err error) {
+	return string(s), nil
+}
+
+func (s StaticTokenSource) Invalidate(accessToken string) {}
+
+type RefreshTokenSourceOptions struct {
+	ClientId string
+	// empty for public clients
+	ClientSecret string
+	// used if Store is nil or holds no refresh token
+	RefreshToken string
+	// if set, rotated refresh tokens are loaded from and written back here
+	Store RefreshTokenStore
+}
+
+// hands out access tokens to concurrent fetchers, refreshing them shortly
+// before expiry or after ESI rejects one
+type RefreshTokenSource struct {
+	mu          sync.Mutex
+	client      *Client
+	opts        RefreshTokenSourceOptions
+	accessToken string
+	expires     time.Time
+}
+
+func (c *Client) NewRefreshTokenSource(opts RefreshTokenSourceOptions) *RefreshTokenSource {
+	return &RefreshTokenSource{client: c, opts: opts}
+}
+
+func (t *RefreshTokenSource) Token(ctx context.Context) (accessToken string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.accessToken != "" && time.Until(t.expires) > tokenRefreshMargin {
+		return t.accessToken, nil
+	}
+
+	accessToken, expires, err := t.client.authenticateWithStore(
+		ctx,
+		t.opts.ClientId,
+		t.opts.ClientSecret,
+		t.opts.RefreshToken,
+		t.opts.Store,
+	)
+	if err != nil {
+		return "", &AuthError{Err: err}
+	}
+	t.accessToken, t.expires = accessToken, expires
+
+	return accessToken, nil
+}
+
+// forces the next call to Token to refresh, unless another caller already
+// replaced accessToken
+func (t *RefreshTokenSource) Invalidate(accessToken string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.accessToken == accessToken {
+		t.accessToken = ""
+	}
+}
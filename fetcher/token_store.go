@@ -0,0 +1,210 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// persists the refresh token of one character, which SSO rotates on every
+// refresh
+type RefreshTokenStore interface {
+	// held across a refresh so that concurrent runs do not rotate the same
+	// refresh token
+	Lock(ctx context.Context) (unlock func() error, err error)
+	// returns an empty string if no token is stored
+	Load() (refreshToken string, err error)
+	// the caller must hold the lock
+	Store(refreshToken string) error
+}
+
+// reads and writes the 'refresh_token' key of a JSON object file, leaving
+// every other key untouched
+type FileTokenStore struct {
+	Path string
+	// if set, the token belongs to the entry of the 'identities' array with
+	// this name instead of the top level object
+	Identity string
+}
+
+func (s FileTokenStore) Lock(ctx context.Context) (unlock func() error, err error) {
+	return lockFile(ctx, s.Path)
+}
+
+// returns an empty string if the file does not exist or has no token
+func (s FileTokenStore) Load() (refreshToken string, err error) {
+	object, err := s.readObject()
+	if err != nil {
+		return "", err
+	}
+	target, _, err := s.target(object)
+	if err != nil {
+		return "", err
+	}
+	raw, ok := target["refresh_token"]
+	if !ok {
+		return "", nil
+	}
+	err = json.Unmarshal(raw, &refreshToken)
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// the caller must hold the lock
+func (s FileTokenStore) Store(refreshToken string) error {
+	object, err := s.readObject()
+	if err != nil {
+		return err
+	}
+	target, commit, err := s.target(object)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(refreshToken)
+	if err != nil {
+		return err
+	}
+	target["refresh_token"] = raw
+	err = commit()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(object, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, append(data, '\n'), 0600)
+}
+
+func (s FileTokenStore) readObject() (object map[string]json.RawMessage, err error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]json.RawMessage), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	object = make(map[string]json.RawMessage)
+	err = json.Unmarshal(data, &object)
+	if err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// returns the object holding the token, and a function that writes changes
+// to it back into object
+func (s FileTokenStore) target(object map[string]json.RawMessage) (
+	target map[string]json.RawMessage,
+	commit func() error,
+	err error,
+) {
+	if s.Identity == "" {
+		return object, func() error { return nil }, nil
+	}
+
+	identities := make([]map[string]json.RawMessage, 0)
+	if raw, ok := object["identities"]; ok {
+		err = json.Unmarshal(raw, &identities)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, identity := range identities {
+		var name string
+		json.Unmarshal(identity["name"], &name)
+		if name != s.Identity {
+			continue
+		}
+		return identity, func() error {
+			raw, err := json.Marshal(identities)
+			if err != nil {
+				return err
+			}
+			object["identities"] = raw
+			return nil
+		}, nil
+	}
+
+	return nil, nil, fmt.Errorf("identity '%s' not found in '%s'", s.Identity, s.Path)
+}
+
+// authenticates with the stored refresh token, holding the store's lock until
+// the rotated refresh token has been written back
+//
+// without a store, fallbackRefreshToken is used and rotations are discarded
+func (c *Client) authenticateWithStore(
+	ctx context.Context,
+	clientId string,
+	clientSecret string,
+	fallbackRefreshToken string,
+	store RefreshTokenStore,
+) (
+	accessToken string,
+	expires time.Time,
+	err error,
+) {
+	if store == nil {
+		accessToken, _, expires, err = c.authenticate(
+			ctx,
+			clientId,
+			clientSecret,
+			fallbackRefreshToken,
+		)
+		return accessToken, expires, err
+	}
+
+	unlock, err := store.Lock(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer unlock()
+
+	refreshToken, err := store.Load()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if refreshToken == "" {
+		refreshToken = fallbackRefreshToken
+	}
+
+	accessToken, newRefreshToken, expires, err := c.authenticate(
+		ctx,
+		clientId,
+		clientSecret,
+		refreshToken,
+	)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if newRefreshToken != "" && newRefreshToken != refreshToken {
+		err = store.Store(newRefreshToken)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+	}
+
+	return accessToken, expires, nil
+}
+
+// locks the store and writes refreshToken
+func StoreRefreshToken(
+	ctx context.Context,
+	store RefreshTokenStore,
+	refreshToken string,
+) error {
+	unlock, err := store.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return store.Store(refreshToken)
+}
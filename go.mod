@@ -1,3 +1,5 @@
 module github.com/WiggidyW/eve_industry_program_fetcher
 
 go 1.21.3
+
+require github.com/mattn/go-sqlite3 v1.14.22
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/WiggidyW/eve_industry_program_fetcher/fetcher"
+)
+
+func runLogin(args []string) error {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	callbackUrl := flags.String("callback_url", "", "Override the configured callback URL")
+	identityName := flags.String("identity", "", "Name of the identity to log in as")
+	ssoBaseUrl := flags.String("sso_base_url", "", "Override the SSO base URL")
+	flags.Parse(args)
+
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	if *callbackUrl != "" {
+		config.CallbackUrl = *callbackUrl
+	}
+	if *ssoBaseUrl != "" {
+		config.SsoBaseUrl = *ssoBaseUrl
+	}
+	if *identityName == "" && len(config.Identities) > 0 {
+		return fmt.Errorf("config has identities, '-identity' is required")
+	}
+	identity, err := config.Identity(*identityName)
+	if err != nil {
+		return err
+	}
+
+	client, err := config.NewClient("", "")
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	refreshToken, err := client.Login(ctx, fetcher.LoginOptions{
+		ClientId:     identity.ClientId,
+		ClientSecret: identity.ClientSecret,
+		CallbackUrl:  config.CallbackUrl,
+		Scopes:       config.Scopes,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = fetcher.StoreRefreshToken(ctx, identity.TokenStore(), refreshToken)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Logged in, refresh token saved")
+	return nil
+}
@@ -1,78 +1,392 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/WiggidyW/eve_industry_program_fetcher/fetcher"
+	"github.com/WiggidyW/eve_industry_program_fetcher/sqlite"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "login" {
+		if err := runLogin(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	} else if len(os.Args) > 1 && os.Args[1] == "quote" {
+		if err := runQuote(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	} else if len(os.Args) > 1 && os.Args[1] == "diff" {
+		if err := runDiff(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	os.Exit(run())
+}
+
+// fetches the datasets selected by flags and config, returning the process's
+// exit code so that deferred cleanup runs before exiting
+func run() int {
 	get_adjusted_prices := flag.Bool("adjusted_prices", false, "Get adjusted prices")
 	get_cost_indices := flag.Bool("cost_indices", false, "Get cost indices")
 	get_market_orders := flag.Bool("market_orders", false, "Get market orders")
 	get_assets := flag.Bool("assets", false, "Get assets")
+	identity_name := flag.String("identity", "", "Only fetch for the identity with this name")
+	max_in_flight := flag.Int("max_in_flight", 0, "Override the maximum number of concurrent requests")
+	max_in_flight_per_host := flag.Int("max_in_flight_per_host", 0, "Override the maximum number of concurrent requests per host")
+	force := flag.Bool("force", false, "Fetch datasets even if their previous output has not expired")
+	no_cache := flag.Bool("no_cache", false, "Always download full responses instead of using the response cache")
+	esi_base_url := flag.String("esi_base_url", "", "Override the ESI base URL")
+	esi_version := flag.String("esi_version", "", "Override the ESI route version")
+	esi_datasource := flag.String("esi_datasource", "", "Override the ESI datasource")
+	sso_base_url := flag.String("sso_base_url", "", "Override the SSO base URL")
+	record_dir := flag.String("record", "", "Record ESI responses into this fixture directory")
+	replay_dir := flag.String("replay", "", "Serve ESI responses from this fixture directory instead of the network")
+	out_dir := flag.String("out_dir", "", "Override the directory outputs are written to")
+	history := flag.Int("history", -1, "Override how many timestamped copies of each output are kept, 0 disables history")
+	formats := flag.String("format", "", "Override the comma separated output formats: json, csv, ndjson, msgpack, any suffixed with '.gz'")
+	sqlite_path := flag.String("sqlite", "", "Override the SQLite database outputs are also stored in")
+	envelope := flag.Bool("envelope", false, "Wrap outputs in an envelope describing how they were fetched")
+	keep_going := flag.Bool("keep_going", false, "Write market orders even if some regions or structures fail, listing them as missing")
+	full_orders := flag.Bool("full_orders", false, "Also list every market order with its ID, issue time, minimum volume and range")
+	order_depth := flag.Uint64("order_depth", 0, "Override the units each market order book is truncated to cover")
+	timeout := flag.Duration("timeout", 0, "Abort the run if it takes longer than this, e.g. '5m'")
 	flag.Parse()
 
 	config, err := LoadConfig()
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
+		return exitFailure
 	}
-
-	accessToken, _, err := authenticate(
-		config.ClientId,
-		config.ClientSecret,
-		config.RefreshToken,
-	)
+	if *max_in_flight > 0 {
+		config.MaxInFlight = *max_in_flight
+	}
+	if *max_in_flight_per_host > 0 {
+		config.MaxInFlightPerHost = *max_in_flight_per_host
+	}
+	if *esi_base_url != "" {
+		config.EsiBaseUrl = *esi_base_url
+	}
+	if *esi_version != "" {
+		config.EsiVersion = *esi_version
+	}
+	if *esi_datasource != "" {
+		config.EsiDatasource = *esi_datasource
+	}
+	if *sso_base_url != "" {
+		config.SsoBaseUrl = *sso_base_url
+	}
+	if *out_dir != "" {
+		config.OutDir = *out_dir
+	}
+	if *history >= 0 {
+		config.History = *history
+	}
+	if *envelope {
+		config.Envelope = true
+	}
+	if *full_orders {
+		config.FullOrders = true
+	}
+	if *order_depth > 0 {
+		config.OrderDepth = *order_depth
+	}
+	if *formats != "" {
+		config.Formats = strings.Split(*formats, ",")
+	}
+	encoders, err := config.Encoders()
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
+		return exitFailure
+	}
+	if *sqlite_path != "" {
+		config.SqlitePath = *sqlite_path
+	}
+	var store *sqlite.Store
+	if config.SqlitePath != "" {
+		store, err = sqlite.Open(config.SqlitePath)
+		if err != nil {
+			log.Println(err)
+			return exitFailure
+		}
+		defer func() {
+			if err := store.Close(); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+	if *no_cache {
+		config.CacheDir = ""
+	}
+	client, err := config.NewClient(*record_dir, *replay_dir)
+	if err != nil {
+		log.Println(err)
+		return exitFailure
 	}
 
-	log.Println("Authenticated")
-
-	i := 0
-	results := make(chan error, 4)
+	// the first signal cancels in-flight requests and lets outputs that are
+	// being written finish, a second one kills the process
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-sigCtx.Done()
+		stop()
+	}()
+	ctx := sigCtx
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
 
+	flagDatasets := make([]string, 0, 4)
 	if *get_adjusted_prices {
-		i++
-		go func() {
-			results <- GetAndWriteAdjustedPrices(accessToken)
-			log.Println("Wrote adjusted prices")
-		}()
+		flagDatasets = append(flagDatasets, DatasetAdjustedPrices)
 	}
-
 	if *get_cost_indices {
-		i++
-		go func() {
-			results <- GetAndWriteCostIndices(accessToken)
-			log.Println("Wrote cost indices")
-		}()
+		flagDatasets = append(flagDatasets, DatasetCostIndices)
 	}
-
 	if *get_market_orders {
-		i++
-		go func() {
-			results <- GetAndWriteMarketOrders(
-				accessToken,
-				config.LocationIds,
-				config.RegionIds,
-			)
-			log.Println("Wrote market orders")
-		}()
+		flagDatasets = append(flagDatasets, DatasetMarketOrders)
 	}
-
 	if *get_assets {
-		i++
-		go func() {
-			results <- GetAndWriteAssets(
-				accessToken,
-				config.CorporationId,
+		flagDatasets = append(flagDatasets, DatasetAssets)
+	}
+
+	identities := config.ResolvedIdentities()
+	if *identity_name != "" {
+		identity, err := config.Identity(*identity_name)
+		if err != nil {
+			log.Println(err)
+			return exitFailure
+		}
+		identities = []Identity{identity}
+	}
+
+	marketOrders := fetcher.MarketOrdersOptions{
+		KeepGoing: *keep_going,
+		Depth:     config.OrderDepth,
+		Full:      config.FullOrders,
+	}
+
+	i := 0
+	results := make(chan datasetResult, len(allDatasets)*len(identities))
+	summary := make([]datasetResult, 0, len(allDatasets)*len(identities))
+
+	for _, identity := range identities {
+		datasets := identity.SelectDatasets(flagDatasets)
+		if !*force {
+			var skipped []string
+			datasets, skipped = skipFreshDatasets(
+				identity,
+				config.OutputWriter(identity, encoders, store),
+				datasets,
+				marketOrders,
 			)
-			log.Println("Wrote assets")
-		}()
+			for _, dataset := range skipped {
+				summary = append(summary, datasetResult{
+					Identity: identity,
+					Dataset:  dataset,
+					Skipped:  true,
+				})
+			}
+		}
+		if len(datasets) == 0 {
+			continue
+		}
+
+		// a failed identity fails its own authenticated datasets, everything
+		// else carries on
+		var tokens fetcher.TokenSource
+		if *replay_dir != "" {
+			tokens = fetcher.StaticTokenSource("replay")
+		} else if needsTokens(datasets, identity) {
+			tokens, err = authenticateIdentity(ctx, client, identity, datasets)
+			if err != nil {
+				log.Printf("Authentication failed%s: %s\n", identityLabel(identity), err)
+				public := make([]string, 0, len(datasets))
+				for _, dataset := range datasets {
+					if len(requiredScopes(dataset, identity)) == 0 {
+						public = append(public, dataset)
+						continue
+					}
+					summary = append(summary, datasetResult{
+						Identity:   identity,
+						Dataset:    dataset,
+						AuthFailed: true,
+						Err:        err,
+					})
+				}
+				datasets = public
+			}
+		}
+
+		for _, dataset := range datasets {
+			i++
+			go func(identity Identity, tokens fetcher.TokenSource, dataset string) {
+				start := time.Now()
+				err := getAndWriteDataset(
+					ctx,
+					client,
+					identity,
+					config.OutputWriter(identity, encoders, store),
+					tokens,
+					dataset,
+					marketOrders,
+				)
+				results <- datasetResult{
+					Identity: identity,
+					Dataset:  dataset,
+					Duration: time.Since(start),
+					Err:      err,
+				}
+			}(identity, tokens, dataset)
+		}
 	}
 
+	// every dataset runs to completion, even if others fail
 	for j := 0; j < i; j++ {
-		if err := <-results; err != nil {
-			log.Fatal(err)
+		summary = append(summary, <-results)
+	}
+
+	printSummary(summary)
+	return exitCode(summary)
+}
+
+// returns a token source for identity once its access token has been
+// validated and found to have the scopes datasets require
+func authenticateIdentity(
+	ctx context.Context,
+	client *fetcher.Client,
+	identity Identity,
+	datasets []string,
+) (
+	tokens fetcher.TokenSource,
+	err error,
+) {
+	tokens = client.NewRefreshTokenSource(fetcher.RefreshTokenSourceOptions{
+		ClientId:     identity.ClientId,
+		ClientSecret: identity.ClientSecret,
+		RefreshToken: identity.RefreshToken,
+		Store:        identity.TokenStore(),
+	})
+	accessToken, err := tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := client.ValidateAccessToken(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	err = checkDatasetScopes(claims, datasets, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Authenticated%s as '%s'\n", identityLabel(identity), claims.CharacterName)
+	return tokens, nil
+}
+
+func getAndWriteDataset(
+	ctx context.Context,
+	client *fetcher.Client,
+	identity Identity,
+	out fetcher.OutputWriter,
+	tokens fetcher.TokenSource,
+	dataset string,
+	// settings for market orders, the rest is filled in from identity
+	marketOrders fetcher.MarketOrdersOptions,
+) (err error) {
+	switch dataset {
+	case DatasetAdjustedPrices:
+		err = client.GetAndWriteAdjustedPrices(ctx, out)
+	case DatasetCostIndices:
+		err = client.GetAndWriteCostIndices(ctx, out)
+	case DatasetMarketOrders:
+		err = client.GetAndWriteMarketOrders(
+			ctx,
+			marketOrdersOptions(identity, tokens, marketOrders),
+			out,
+		)
+	case DatasetAssets:
+		err = client.GetAndWriteAssets(ctx, assetsOptions(identity, tokens), out)
+	}
+	var missingErr *fetcher.MissingOrdersError
+	if errors.As(err, &missingErr) {
+		log.Printf(
+			"Wrote partial %s%s, %s\n",
+			strings.ReplaceAll(dataset, "_", " "),
+			identityLabel(identity),
+			err,
+		)
+		return err
+	} else if err != nil {
+		log.Printf(
+			"Error fetching %s%s: %s\n",
+			strings.ReplaceAll(dataset, "_", " "),
+			identityLabel(identity),
+			err,
+		)
+		return err
+	}
+
+	log.Printf(
+		"Wrote %s%s\n",
+		strings.ReplaceAll(dataset, "_", " "),
+		identityLabel(identity),
+	)
+	return nil
+}
+
+// splits datasets into those whose previous output has expired and those
+// that are still fresh
+func skipFreshDatasets(
+	identity Identity,
+	out fetcher.OutputWriter,
+	datasets []string,
+	marketOrders fetcher.MarketOrdersOptions,
+) (
+	stale []string,
+	skipped []string,
+) {
+	stale = make([]string, 0, len(datasets))
+	for _, dataset := range datasets {
+		expires, fresh := datasetFreshUntil(
+			dataset,
+			out,
+			datasetInputs(dataset, identity, marketOrders),
+		)
+		if !fresh {
+			stale = append(stale, dataset)
+			continue
 		}
+		skipped = append(skipped, dataset)
+		log.Printf(
+			"Skipped %s%s, fresh until %s\n",
+			strings.ReplaceAll(dataset, "_", " "),
+			identityLabel(identity),
+			expires.Format(time.RFC1123),
+		)
+	}
+	return stale, skipped
+}
+
+func identityLabel(identity Identity) string {
+	if identity.Name == "" {
+		return ""
 	}
+	return " for '" + identity.Name + "'"
 }
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/WiggidyW/eve_industry_program_fetcher/fetcher"
+)
+
+func runQuote(args []string) error {
+	flags := flag.NewFlagSet("quote", flag.ExitOnError)
+	identityName := flags.String("identity", "", "Name of the identity whose market orders are quoted")
+	outDir := flags.String("out_dir", "", "Override the directory outputs were written to")
+	formats := flags.String("format", "", "Override the comma separated formats outputs were written in, one of them 'json' or 'json.gz'")
+	ordersFile := flags.String("orders", "", "Quote from this 'json' or 'json.gz' market orders file instead of the identity's")
+	typeId := flags.Int("type", 0, "Type ID to quote")
+	quantity := flags.Uint64("quantity", 0, "Units of -type to quote")
+	billFile := flags.String("bill", "", "Quote every item of this bill of materials, a JSON list of {\"type_id\", \"quantity\"}")
+	locations := flags.String("locations", "", "Comma separated location IDs to choose the cheapest of, defaults to every location")
+	sell := flags.Bool("sell", false, "Quote selling into buy orders instead of buying from sell orders")
+	jsonOut := flags.Bool("json", false, "Print the quote as JSON")
+	flags.Parse(args)
+
+	var items []fetcher.QuoteItem
+	if *billFile != "" && *typeId != 0 {
+		return fmt.Errorf("'-bill' and '-type' are mutually exclusive")
+	} else if *billFile != "" {
+		data, err := os.ReadFile(*billFile)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(data, &items); err != nil {
+			return fmt.Errorf("error parsing bill of materials '%s': %w", *billFile, err)
+		}
+	} else if *typeId != 0 && *quantity > 0 {
+		items = []fetcher.QuoteItem{{TypeId: int32(*typeId), Quantity: *quantity}}
+	} else {
+		return fmt.Errorf("either '-bill' or '-type' and '-quantity' are required")
+	}
+
+	opts := fetcher.QuoteOptions{Sell: *sell}
+	if *locations != "" {
+		for _, v := range strings.Split(*locations, ",") {
+			locationId, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid location ID '%s': %w", v, err)
+			}
+			opts.LocationIds = append(opts.LocationIds, locationId)
+		}
+	}
+
+	path := *ordersFile
+	if path == "" {
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		if *outDir != "" {
+			config.OutDir = *outDir
+		}
+		if *formats != "" {
+			config.Formats = strings.Split(*formats, ",")
+		}
+		identity, err := config.Identity(*identityName)
+		if err != nil {
+			return err
+		}
+		encoders, err := config.Encoders()
+		if err != nil {
+			return err
+		}
+		path, err = marketOrdersPath(config.OutputWriter(identity, encoders, nil))
+		if err != nil {
+			return err
+		}
+	}
+	orders, inputs, _, err := readMarketOrders(path)
+	if err != nil {
+		return err
+	}
+	if !orders.Full() {
+		fmt.Fprintln(os.Stderr, "warning: market orders do not list their orders, so minimum volumes are not applied, fetch them with '-full_orders' to apply them")
+	}
+	if inputs.Depth > 0 {
+		fmt.Fprintf(os.Stderr, "warning: market orders were truncated to %d units per book with '-order_depth', larger quantities may fill less or cost more than quoted\n", inputs.Depth)
+	}
+
+	billQuote := orders.QuoteBill(items, opts)
+	if *jsonOut {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(billQuote)
+	}
+	printQuote(billQuote)
+	return nil
+}
+
+// reads a JSON market orders output, with or without an envelope, returning
+// the inputs it was fetched with and when it was fetched
+//
+// without an envelope, the inputs are read from the meta file beside it if
+// there is one, and it was fetched when it was last modified
+func readMarketOrders(path string) (
+	orders fetcher.SerializableLocationOrders,
+	inputs fetcher.EnvelopeInputs,
+	fetchedAt time.Time,
+	err error,
+) {
+	// gzipped outputs have the meta file of the plain name
+	name, gzipped := strings.CutSuffix(path, ".gz")
+	if filepath.Ext(name) != ".json" {
+		return nil, inputs, time.Time{}, fmt.Errorf(
+			"market orders '%s' must be a 'json' or 'json.gz' output",
+			path,
+		)
+	}
+	data, err := readFileMaybeGzipped(path, gzipped)
+	if err != nil {
+		return nil, inputs, time.Time{}, err
+	}
+	envelope, err := fetcher.UnmarshalOutput(data, &orders)
+	if err != nil {
+		return nil, inputs, time.Time{}, fmt.Errorf("error parsing market orders '%s': %w", path, err)
+	} else if envelope != nil && envelope.SchemaVersion != fetcher.SchemaVersion {
+		return nil, inputs, time.Time{}, fmt.Errorf(
+			"market orders '%s' have schema version %d, expected %d, fetch them again",
+			path,
+			envelope.SchemaVersion,
+			fetcher.SchemaVersion,
+		)
+	} else if envelope != nil {
+		return orders, envelope.Inputs, envelope.FetchedAt, nil
+	}
+
+	meta, err := fetcher.ReadOutputMeta(filepath.Dir(name), filepath.Base(name))
+	if err == nil {
+		// the inputs in the meta leave out which sources went missing
+		inputs = meta.Inputs.Fetch
+		inputs.Missing = meta.Missing
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, inputs, time.Time{}, fmt.Errorf("error reading meta of market orders '%s': %w", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, inputs, time.Time{}, err
+	}
+	return orders, inputs, info.ModTime(), nil
+}
+
+// the path of out's market orders output that can be read, either its 'json'
+// or its 'json.gz' output
+func marketOrdersPath(out fetcher.OutputWriter) (path string, err error) {
+	names := out.EncodedNames(fetcher.MarketOrdersFile)
+	for _, ext := range []string{".json", ".json.gz"} {
+		for _, name := range names {
+			if strings.HasSuffix(name, ext) {
+				return out.Path(name), nil
+			}
+		}
+	}
+	return "", fmt.Errorf(
+		"market orders are only written as %s, a 'json' or 'json.gz' format is required",
+		strings.Join(names, ", "),
+	)
+}
+
+func readFileMaybeGzipped(path string, gzipped bool) (data []byte, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if !gzipped {
+		return io.ReadAll(file)
+	}
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing '%s': %w", path, err)
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func printQuote(billQuote fetcher.BillQuote) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "TYPE\tLOCATION\tQUANTITY\tFILLED\tFILL%\tTOTAL\tAVERAGE\tMARGINAL\tLEVELS\t")
+	for _, quote := range billQuote.Quotes {
+		location := "-"
+		if quote.LocationId != 0 {
+			location = strconv.FormatInt(quote.LocationId, 10)
+		}
+		fmt.Fprintf(
+			w,
+			"%d\t%s\t%d\t%d\t%.1f\t%.2f\t%.2f\t%.2f\t%d\t\n",
+			quote.TypeId,
+			location,
+			quote.Quantity,
+			quote.Filled,
+			quote.FillPercent,
+			quote.TotalCost,
+			quote.AveragePrice,
+			quote.MarginalPrice,
+			len(quote.Levels),
+		)
+	}
+	if len(billQuote.Quotes) > 1 {
+		fmt.Fprintf(w, "TOTAL\t\t\t\t\t%.2f\t\t\t\t\n", billQuote.TotalCost)
+	}
+	w.Flush()
+
+	if !billQuote.Complete {
+		fmt.Fprintln(os.Stderr, "warning: not every item could be filled in full")
+	}
+}
@@ -0,0 +1,308 @@
+// Package sqlite stores fetched datasets in a SQLite database, keeping one
+// snapshot per dataset per run so that their history can be queried, e.g.
+//
+//	SELECT s.fetched_at, p.adjusted_price
+//	FROM adjusted_prices p JOIN snapshots s ON s.id = p.snapshot_id
+//	WHERE p.type_id = 34 AND s.fetched_at > unixepoch() - 90*24*60*60
+//	ORDER BY s.fetched_at
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/WiggidyW/eve_industry_program_fetcher/fetcher"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// times are stored as unix seconds, zero if unknown
+const schema = `
+CREATE TABLE IF NOT EXISTS snapshots (
+	id            INTEGER PRIMARY KEY,
+	dataset       TEXT    NOT NULL,
+	identity      TEXT    NOT NULL,
+	fetched_at    INTEGER NOT NULL,
+	expires       INTEGER NOT NULL,
+	last_modified INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS snapshots_dataset
+	ON snapshots (dataset, identity, fetched_at);
+
+CREATE TABLE IF NOT EXISTS adjusted_prices (
+	snapshot_id    INTEGER NOT NULL REFERENCES snapshots (id) ON DELETE CASCADE,
+	type_id        INTEGER NOT NULL,
+	adjusted_price REAL    NOT NULL,
+	PRIMARY KEY (snapshot_id, type_id)
+);
+CREATE INDEX IF NOT EXISTS adjusted_prices_type
+	ON adjusted_prices (type_id, snapshot_id);
+
+CREATE TABLE IF NOT EXISTS cost_indices (
+	snapshot_id   INTEGER NOT NULL REFERENCES snapshots (id) ON DELETE CASCADE,
+	system_id     INTEGER NOT NULL,
+	manufacturing REAL    NOT NULL,
+	invention     REAL    NOT NULL,
+	reaction      REAL    NOT NULL,
+	copy          REAL    NOT NULL,
+	PRIMARY KEY (snapshot_id, system_id)
+);
+CREATE INDEX IF NOT EXISTS cost_indices_system
+	ON cost_indices (system_id, snapshot_id);
+
+CREATE TABLE IF NOT EXISTS market_orders (
+	snapshot_id  INTEGER NOT NULL REFERENCES snapshots (id) ON DELETE CASCADE,
+	location_id  INTEGER NOT NULL,
+	type_id      INTEGER NOT NULL,
+	is_buy_order INTEGER NOT NULL DEFAULT 0,
+	price        REAL    NOT NULL,
+	volume       INTEGER NOT NULL,
+	orders       INTEGER NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS market_orders_location_type
+	ON market_orders (snapshot_id, location_id, type_id);
+CREATE INDEX IF NOT EXISTS market_orders_type
+	ON market_orders (type_id, location_id, snapshot_id);
+
+-- only written for full market orders, alongside their levels
+CREATE TABLE IF NOT EXISTS market_order_entries (
+	snapshot_id  INTEGER NOT NULL REFERENCES snapshots (id) ON DELETE CASCADE,
+	location_id  INTEGER NOT NULL,
+	type_id      INTEGER NOT NULL,
+	is_buy_order INTEGER NOT NULL,
+	price        REAL    NOT NULL,
+	order_id     INTEGER NOT NULL,
+	volume       INTEGER NOT NULL,
+	volume_total INTEGER NOT NULL,
+	min_volume   INTEGER NOT NULL,
+	issued       INTEGER NOT NULL,
+	duration     INTEGER NOT NULL,
+	range        TEXT    NOT NULL,
+	system_id    INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS market_order_entries_location_type
+	ON market_order_entries (snapshot_id, location_id, type_id);
+CREATE INDEX IF NOT EXISTS market_order_entries_order
+	ON market_order_entries (order_id, snapshot_id);
+
+CREATE TABLE IF NOT EXISTS assets (
+	snapshot_id INTEGER NOT NULL REFERENCES snapshots (id) ON DELETE CASCADE,
+	location_id INTEGER NOT NULL,
+	type_id     INTEGER NOT NULL,
+	runs        INTEGER NOT NULL,
+	me          INTEGER NOT NULL,
+	te          INTEGER NOT NULL,
+	quantity    INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS assets_location
+	ON assets (snapshot_id, location_id);
+CREATE INDEX IF NOT EXISTS assets_type
+	ON assets (type_id, snapshot_id);
+`
+
+type Store struct {
+	db *sql.DB
+}
+
+// opens the database at path, creating it and its tables if needed
+func Open(path string) (store *Store, err error) {
+	db, err := sql.Open(
+		"sqlite3",
+		fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on", path),
+	)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, so concurrent datasets take turns
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(schema)
+	if err == nil {
+		err = migrate(db)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating schema in '%s': %w", path, err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// columns added to tables after they were first created, with definitions
+// whose defaults describe the rows written before
+var migrations = []struct {
+	table, column, definition string
+}{
+	// buy orders were never stored
+	{"market_orders", "is_buy_order", "INTEGER NOT NULL DEFAULT 0"},
+	// each row was a single order
+	{"market_orders", "orders", "INTEGER NOT NULL DEFAULT 1"},
+}
+
+// brings tables created by older versions up to date with schema
+func migrate(db *sql.DB) error {
+	for _, m := range migrations {
+		exists, err := hasColumn(db, m.table, m.column)
+		if err != nil {
+			return err
+		} else if exists {
+			continue
+		}
+		_, err = db.Exec(fmt.Sprintf(
+			"ALTER TABLE %s ADD COLUMN %s %s",
+			m.table,
+			m.column,
+			m.definition,
+		))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasColumn(db *sql.DB, table, column string) (exists bool, err error) {
+	err = db.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`,
+		table,
+		column,
+	).Scan(&exists)
+	return exists, err
+}
+
+func (s *Store) Close() error { return s.db.Close() }
+
+// returns a sink recording snapshots under identity
+func (s *Store) Sink(identity string) fetcher.Sink {
+	return sink{store: s, identity: identity}
+}
+
+type sink struct {
+	store    *Store
+	identity string
+}
+
+func (k sink) WriteDataset(
+	ctx context.Context,
+	dataset string,
+	serializable fetcher.Serializable,
+	snapshot fetcher.Snapshot,
+) error {
+	return k.store.WriteDataset(ctx, k.identity, dataset, serializable, snapshot)
+}
+
+// inserts a snapshot and its rows in one transaction
+func (s *Store) WriteDataset(
+	ctx context.Context,
+	identity string,
+	dataset string,
+	serializable fetcher.Serializable,
+	snapshot fetcher.Snapshot,
+) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	res, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO snapshots (dataset, identity, fetched_at, expires, last_modified)
+		VALUES (?, ?, ?, ?, ?)`,
+		dataset,
+		identity,
+		time.Now().Unix(),
+		unix(snapshot.Expires),
+		unix(snapshot.LastModified),
+	)
+	if err != nil {
+		return err
+	}
+	snapshotId, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	switch v := serializable.(type) {
+	case fetcher.SerializableAdjustedPrices:
+		err = insertRows(ctx, tx, snapshotId, `INSERT INTO adjusted_prices
+			(snapshot_id, type_id, adjusted_price) VALUES (?, ?, ?)`, v)
+	case fetcher.SerializableCostIndices:
+		err = insertRows(ctx, tx, snapshotId, `INSERT INTO cost_indices
+			(snapshot_id, system_id, manufacturing, invention, reaction, copy)
+			VALUES (?, ?, ?, ?, ?, ?)`, v)
+	case fetcher.SerializableLocationOrders:
+		err = insertMarketOrders(ctx, tx, snapshotId, v)
+	case fetcher.SerializableFullLocationOrders:
+		err = insertMarketOrders(ctx, tx, snapshotId, fetcher.SerializableLocationOrders(v))
+		if err == nil {
+			err = insertRows(ctx, tx, snapshotId, `INSERT INTO market_order_entries
+				(snapshot_id, location_id, type_id, is_buy_order, price, order_id,
+				volume, volume_total, min_volume, issued, duration, range, system_id)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, v)
+		}
+	case fetcher.SerializableLocationOutAssets:
+		err = insertRows(ctx, tx, snapshotId, `INSERT INTO assets
+			(snapshot_id, location_id, type_id, runs, me, te, quantity)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, v)
+	default:
+		err = fmt.Errorf("cannot store dataset '%s' of type %T", dataset, serializable)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertMarketOrders(
+	ctx context.Context,
+	tx *sql.Tx,
+	snapshotId int64,
+	orders fetcher.SerializableLocationOrders,
+) error {
+	return insertRows(ctx, tx, snapshotId, `INSERT INTO market_orders
+		(snapshot_id, location_id, type_id, is_buy_order, price, volume, orders)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, orders)
+}
+
+// the columns of each table match the serializable's Rows, with times stored
+// as unix seconds
+func insertRows(
+	ctx context.Context,
+	tx *sql.Tx,
+	snapshotId int64,
+	query string,
+	serializable fetcher.Serializable,
+) error {
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range serializable.Rows() {
+		args := append([]any{snapshotId}, row...)
+		for i, arg := range args {
+			if t, ok := arg.(time.Time); ok {
+				args[i] = unix(t)
+			}
+		}
+		if _, err = stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
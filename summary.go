@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/WiggidyW/eve_industry_program_fetcher/fetcher"
+)
+
+// exit codes, one per failure class so that schedulers can tell them apart
+const (
+	exitOk = 0
+	// failures of several classes, or of none below
+	exitFailure = 1
+	exitAuth    = 2
+	exitNetwork = 3
+	exitEsi     = 4
+	exitWrite   = 5
+)
+
+const (
+	statusOk      = "ok"
+	statusSkipped = "skipped"
+	statusPartial = "partial"
+	statusFailed  = "failed"
+)
+
+type datasetResult struct {
+	Identity Identity
+	Dataset  string
+	Duration time.Duration
+	Skipped  bool
+	// set for failures that happen before the dataset is fetched
+	AuthFailed bool
+	Err        error
+}
+
+func (r datasetResult) status() string {
+	var missingErr *fetcher.MissingOrdersError
+	if r.Skipped {
+		return statusSkipped
+	} else if r.Err == nil {
+		return statusOk
+	} else if errors.As(r.Err, &missingErr) {
+		return statusPartial
+	}
+	return statusFailed
+}
+
+// returns exitOk if the dataset did not fail
+func (r datasetResult) exitCode() int {
+	if r.Err == nil {
+		return exitOk
+	} else if r.AuthFailed {
+		return exitAuth
+	}
+	return classifyError(r.Err)
+}
+
+func classifyError(err error) int {
+	var authErr *fetcher.AuthError
+	var writeErr *fetcher.WriteError
+	var statusErr fetcher.StatusError
+	var urlErr *url.Error
+	var netErr net.Error
+	hasStatus := errors.As(err, &statusErr)
+
+	if errors.Is(err, context.Canceled) {
+		return exitFailure
+	} else if errors.As(err, &authErr) {
+		return exitAuth
+	} else if hasStatus && (statusErr.StatusCode == 401 || statusErr.StatusCode == 403) {
+		return exitAuth
+	} else if errors.As(err, &writeErr) {
+		return exitWrite
+	} else if hasStatus && statusErr.StatusCode >= 500 {
+		return exitEsi
+	} else if errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &urlErr) ||
+		errors.As(err, &netErr) {
+		return exitNetwork
+	}
+	return exitFailure
+}
+
+// the shared exit code of every failed dataset, or exitFailure if they failed
+// for different reasons
+func exitCode(results []datasetResult) int {
+	code := exitOk
+	for _, result := range results {
+		resultCode := result.exitCode()
+		if resultCode == exitOk {
+			continue
+		} else if code == exitOk {
+			code = resultCode
+		} else if code != resultCode {
+			return exitFailure
+		}
+	}
+	return code
+}
+
+func printSummary(results []datasetResult) {
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IDENTITY\tDATASET\tSTATUS\tDURATION\tERROR")
+	for _, result := range results {
+		identity := result.Identity.Name
+		if identity == "" {
+			identity = "-"
+		}
+		var errMsg string
+		if result.Err != nil {
+			errMsg = strings.ReplaceAll(result.Err.Error(), "\n", " ")
+		}
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\n",
+			identity,
+			result.Dataset,
+			result.status(),
+			result.Duration.Round(time.Millisecond),
+			errMsg,
+		)
+	}
+	w.Flush()
+}